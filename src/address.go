@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+)
+
+//Bech32 地址的人类可读前缀是当前网络的 Bech32HRP，数据部分是见证版本号 + 公钥哈希，与比特币的 P2WPKH 地址格式相同
+//版本 0 使用 Bech32 校验和，版本 1 使用 Bech32m 校验和（BIP350）
+//锁定脚本只有公钥哈希，版本号不影响输出，Schnorr 公钥的地址使用版本 1，其他公钥使用版本 0
+const (
+	witnessVersionECDSA   = 0
+	witnessVersionSchnorr = 1
+)
+
+//RIPEMD-160 哈希的长度
+const pubKeyHashLen = 20
+
+//由公钥哈希得到 Base58Check 地址：Base58(AddressVersion + PubKeyHash + checksum)
+func encodeBase58Address(pubKeyHash []byte) string {
+	versionedPayload := append([]byte{activeNetParams.AddressVersion}, pubKeyHash...)
+	fullPayload := append(versionedPayload, checksum(versionedPayload)...)
+
+	return string(Base58Encode(fullPayload))
+}
+
+//由公钥哈希得到 Bech32 或 Bech32m 地址
+func encodeBech32Address(witnessVersion byte, pubKeyHash []byte) string {
+	program, err := convertBits(pubKeyHash, 8, 5, true)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	encoding := Bech32
+	if witnessVersion != witnessVersionECDSA {
+		encoding = Bech32m
+	}
+
+	return Bech32Encode(activeNetParams.Bech32HRP, append([]byte{witnessVersion}, program...), encoding)
+}
+
+//判断地址是否是 Bech32 格式：以人类可读前缀和分隔符开头，不区分大小写
+func isBech32Address(address string) bool {
+	return strings.HasPrefix(strings.ToLower(address), activeNetParams.Bech32HRP+string(bech32Separator))
+}
+
+//解码 Base58Check 或 Bech32 地址，返回其中的公钥哈希
+//地址错误时返回 *AddressError，尽可能指出写错的字符的位置
+func DecodeAddress(address string) ([]byte, error) {
+	if isBech32Address(address) {
+		return decodeBech32Address(address)
+	}
+
+	return decodeBase58Address(address)
+}
+
+func decodeBech32Address(address string) ([]byte, error) {
+	hrp, data, encoding, err := Bech32Decode(address)
+	if err != nil {
+		return nil, err
+	}
+	if hrp != activeNetParams.Bech32HRP {
+		return nil, &AddressError{0, "Wrong human-readable prefix " + hrp}
+	}
+	//数据部分从人类可读前缀和分隔符之后开始
+	start := len(hrp) + 1
+	if len(data) == 0 {
+		return nil, &AddressError{start, "Missing witness version"}
+	}
+
+	witnessVersion := data[0]
+	switch {
+	case witnessVersion == witnessVersionECDSA && encoding != Bech32:
+		return nil, &AddressError{-1, "Version 0 address must use Bech32, not Bech32m"}
+	case witnessVersion == witnessVersionSchnorr && encoding != Bech32m:
+		return nil, &AddressError{-1, "Version 1 address must use Bech32m, not Bech32"}
+	case witnessVersion != witnessVersionECDSA && witnessVersion != witnessVersionSchnorr:
+		return nil, &AddressError{start, "Unsupported witness version"}
+	}
+
+	pubKeyHash, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return nil, &AddressError{-1, err.Error()}
+	}
+	if len(pubKeyHash) != pubKeyHashLen {
+		return nil, &AddressError{-1, "Public key hash has an invalid length"}
+	}
+
+	return pubKeyHash, nil
+}
+
+//解码 Base58Check 地址，包含非 Base58 字符时返回它的位置，
+//校验和错误时尝试找出写错的字符
+func decodeBase58Address(address string) ([]byte, error) {
+	if address == "" {
+		return nil, &AddressError{-1, "Address is empty"}
+	}
+	for i := 0; i < len(address); i++ {
+		if bytes.IndexByte(b58Alphabet, address[i]) < 0 {
+			return nil, &AddressError{i, "Invalid Base58 character"}
+		}
+	}
+
+	pubKeyHash, ok := checkBase58Address(address)
+	if !ok {
+		position := locateTypo(address, 0, string(b58Alphabet), func(candidate string) bool {
+			_, ok := checkBase58Address(candidate)
+			return ok
+		})
+		return nil, &AddressError{position, "Invalid checksum"}
+	}
+
+	return pubKeyHash, nil
+}
+
+//检查 Base58Check 地址的版本号和校验和
+func checkBase58Address(address string) ([]byte, bool) {
+	payload := Base58Decode([]byte(address))
+	if len(payload) <= 1+addressChecksumLen || payload[0] != activeNetParams.AddressVersion {
+		return nil, false
+	}
+
+	versionedPayload := payload[:len(payload)-addressChecksumLen]
+	actualChecksum := payload[len(payload)-addressChecksumLen:]
+	if !bytes.Equal(actualChecksum, checksum(versionedPayload)) {
+		return nil, false
+	}
+
+	return versionedPayload[1:], true
+}
+
+//钱包中的地址以 Base58Check 格式保存，Bech32 地址先转换成同一个公钥哈希的 Base58Check 地址
+//无效的地址原样返回
+func normalizeAddress(address string) string {
+	if !isBech32Address(address) {
+		return address
+	}
+
+	pubKeyHash, err := decodeBech32Address(address)
+	if err != nil {
+		return address
+	}
+
+	return encodeBase58Address(pubKeyHash)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+//地址管理器记录所有已知节点的地址，保存在数据目录的 peers_<节点 ID>.dat 中，重启后继续使用
+//连接失败的地址不会立即删除，而是等待一段时间后重试，等待时间随连续失败次数翻倍
+//连续失败 addrMaxFailures 次并且从未成功连接过的地址才会被删除，配置的种子节点地址不会被删除
+//地址表最多保存 maxKnownAddresses 个地址，满了以后淘汰最差的地址；每个连接最多添加 maxAddrPerPeer 个新地址
+const (
+	addrRetryBase      = 30 * time.Second
+	addrMaxBackoff     = time.Hour
+	addrMaxFailures    = 10
+	addrSaveInterval   = time.Minute
+	addrGossipInterval = 10 * time.Minute
+	addrGossipSize     = 10
+	maxAddrPerMessage  = 1000
+	maxKnownAddresses  = 2000
+	maxAddrPerPeer     = 1000
+)
+
+//一个已知节点地址的状态
+type KnownAddress struct {
+	Addr        string
+	LastSeen    time.Time
+	LastAttempt time.Time
+	LastSuccess time.Time
+	Failures    int
+}
+
+//最近一次尝试之后是否已经过了退避时间
+func (ka *KnownAddress) ready(now time.Time) bool {
+	if ka.Failures == 0 {
+		return true
+	}
+
+	backoff := addrRetryBase << uint(ka.Failures-1)
+	if backoff > addrMaxBackoff || backoff <= 0 {
+		backoff = addrMaxBackoff
+	}
+
+	return now.Sub(ka.LastAttempt) >= backoff
+}
+
+func (ka *KnownAddress) worseThan(other *KnownAddress) bool {
+	if ka.LastSuccess.IsZero() != other.LastSuccess.IsZero() {
+		return ka.LastSuccess.IsZero()
+	}
+	if ka.Failures != other.Failures {
+		return ka.Failures > other.Failures
+	}
+
+	return ka.LastSeen.Before(other.LastSeen)
+}
+
+type AddrManager struct {
+	mu    sync.Mutex
+	file  string
+	addrs map[string]*KnownAddress
+	dirty bool
+
+	//种子节点来自配置，每次启动时设置，不保存到文件中
+	seeds map[string]bool
+}
+
+//节点运行时使用的地址管理器，由 StartServer 创建
+var addrManager = NewAddrManager("")
+
+func NewAddrManager(file string) *AddrManager {
+	return &AddrManager{file: file, addrs: make(map[string]*KnownAddress), seeds: make(map[string]bool)}
+}
+
+//读取地址文件，文件不存在或损坏时从空的地址表开始
+func (am *AddrManager) Load() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	content, err := ioutil.ReadFile(am.file)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logWarn("Failed to read %s: %s", am.file, err)
+		return
+	}
+
+	var addrs []KnownAddress
+	decoder := gob.NewDecoder(bytes.NewReader(content))
+	err = decoder.Decode(&addrs)
+	if err != nil {
+		logWarn("Ignored corrupt address file %s: %s", am.file, err)
+		return
+	}
+
+	for i := range addrs {
+		am.addrs[addrs[i].Addr] = &addrs[i]
+	}
+	logInfo("Loaded %d peer addresses", len(am.addrs))
+}
+
+//地址有变化时写入文件
+func (am *AddrManager) Save() {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	if !am.dirty || am.file == "" {
+		return
+	}
+
+	var addrs []KnownAddress
+	for _, ka := range am.addrs {
+		addrs = append(addrs, *ka)
+	}
+
+	var content bytes.Buffer
+	encoder := gob.NewEncoder(&content)
+	err := encoder.Encode(addrs)
+	if err != nil {
+		logWarn("Failed to encode peer addresses: %s", err)
+		return
+	}
+
+	err = writeFileAtomic(am.file, content.Bytes(), 0600)
+	if err != nil {
+		logWarn("Failed to write %s: %s", am.file, err)
+		return
+	}
+	am.dirty = false
+}
+
+//添加地址，已知的地址只更新 LastSeen，最多添加 limit 个新地址，返回新地址的个数
+func (am *AddrManager) Add(addrs []string, limit int) int {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	added := 0
+	now := time.Now()
+	for _, addr := range addrs {
+		if addr == "" || addr == nodeAddress {
+			continue
+		}
+
+		ka, ok := am.addrs[addr]
+		if !ok {
+			if added >= limit {
+				continue
+			}
+			if len(am.addrs) >= maxKnownAddresses {
+				am.evict()
+			}
+			ka = &KnownAddress{Addr: addr}
+			am.addrs[addr] = ka
+			added++
+		}
+		ka.LastSeen = now
+	}
+	am.dirty = true
+
+	return added
+}
+
+//删除最差的一个地址：从未连接成功过的先于成功过的，失败次数多的先于少的，最久没见过的先于最近见过的
+func (am *AddrManager) evict() {
+	var worst *KnownAddress
+	for _, ka := range am.addrs {
+		if am.seeds[ka.Addr] {
+			continue
+		}
+		if worst == nil || ka.worseThan(worst) {
+			worst = ka
+		}
+	}
+
+	if worst != nil {
+		delete(am.addrs, worst.Addr)
+	}
+}
+
+//添加种子节点的地址，它们不会因为连接失败或地址表已满被删除
+func (am *AddrManager) AddSeeds(addrs []string) {
+	am.mu.Lock()
+	for _, addr := range addrs {
+		am.seeds[addr] = true
+	}
+	am.mu.Unlock()
+
+	am.Add(addrs, len(addrs))
+}
+
+//记录一次连接尝试，成功时由 Good 清除失败次数
+//连续失败太多次并且从未成功连接过的地址被删除，种子节点只会推迟重试
+func (am *AddrManager) Attempt(addr string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	ka, ok := am.addrs[addr]
+	if !ok {
+		return
+	}
+
+	ka.LastAttempt = time.Now()
+	ka.Failures++
+	if ka.Failures >= addrMaxFailures && ka.LastSuccess.IsZero() && !am.seeds[addr] {
+		delete(am.addrs, addr)
+	}
+	am.dirty = true
+}
+
+//与 addr 完成了握手
+func (am *AddrManager) Good(addr string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	ka, ok := am.addrs[addr]
+	if !ok {
+		ka = &KnownAddress{Addr: addr}
+		am.addrs[addr] = ka
+	}
+
+	now := time.Now()
+	ka.LastSeen = now
+	ka.LastSuccess = now
+	ka.Failures = 0
+	am.dirty = true
+}
+
+//可以尝试连接的地址，失败次数少、最近见过的排在前面
+func (am *AddrManager) Candidates() []string {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	now := time.Now()
+	var ready []*KnownAddress
+	for _, ka := range am.addrs {
+		if ka.ready(now) {
+			ready = append(ready, ka)
+		}
+	}
+
+	sort.Slice(ready, func(i, j int) bool {
+		if ready[i].Failures != ready[j].Failures {
+			return ready[i].Failures < ready[j].Failures
+		}
+		return ready[i].LastSeen.After(ready[j].LastSeen)
+	})
+
+	var addrs []string
+	for _, ka := range ready {
+		addrs = append(addrs, ka.Addr)
+	}
+
+	return addrs
+}
+
+//随机选出最多 n 个最近一次连接没有失败的地址，用于回复 getaddr 和定期广播
+func (am *AddrManager) Sample(n int) []string {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	var addrs []string
+	for addr, ka := range am.addrs {
+		if ka.Failures == 0 {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	rand.Shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+	if len(addrs) > n {
+		addrs = addrs[:n]
+	}
+
+	return addrs
+}
+
+func (am *AddrManager) Count() int {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	return len(am.addrs)
+}
+
+//定期保存地址文件，并把一部分好的地址和自己的地址广播给所有连接的节点
+func (am *AddrManager) Run() {
+	saveTicker := time.NewTicker(addrSaveInterval)
+	gossipTicker := time.NewTicker(addrGossipInterval)
+	defer saveTicker.Stop()
+	defer gossipTicker.Stop()
+
+	for {
+		select {
+		case <-saveTicker.C:
+			am.Save()
+		case <-gossipTicker.C:
+			addrs := append(am.Sample(addrGossipSize), nodeAddress)
+			for _, p := range peerManager.Peers() {
+				sendAddr(p, addrs)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAddrManagerLimits(t *testing.T) {
+	am := NewAddrManager("")
+
+	var addrs []string
+	for i := 0; i < 10; i++ {
+		addrs = append(addrs, fmt.Sprintf("10.0.0.%d:3000", i))
+	}
+	if added := am.Add(addrs, 4); added != 4 || am.Count() != 4 {
+		t.Fatalf("added %d of 10 with a limit of 4, %d known", added, am.Count())
+	}
+	//已知的地址不计入上限
+	if added := am.Add(addrs[:5], 1); added != 1 || am.Count() != 5 {
+		t.Fatalf("added %d, %d known", added, am.Count())
+	}
+}
+
+func TestAddrManagerEvictsWorst(t *testing.T) {
+	am := NewAddrManager("")
+
+	var addrs []string
+	for i := 0; i < maxKnownAddresses; i++ {
+		addrs = append(addrs, fmt.Sprintf("10.%d.%d.1:3000", i/256, i%256))
+	}
+	am.Add(addrs, len(addrs))
+
+	good, failing := addrs[0], addrs[1]
+	am.Good(good)
+	am.Attempt(failing)
+	am.addrs[good].LastSeen = time.Now().Add(-time.Hour)
+
+	if added := am.Add([]string{"192.168.0.1:3000"}, 1); added != 1 {
+		t.Fatalf("added %d", added)
+	}
+	if am.Count() != maxKnownAddresses {
+		t.Errorf("%d addresses, the maximum is %d", am.Count(), maxKnownAddresses)
+	}
+	if _, ok := am.addrs[failing]; ok {
+		t.Error("the failing address was not evicted")
+	}
+	if _, ok := am.addrs[good]; !ok {
+		t.Error("the address that connected successfully was evicted")
+	}
+}
+
+func TestAddrManagerKeepsSeeds(t *testing.T) {
+	am := NewAddrManager("")
+	seed, other := "10.0.0.1:3000", "10.0.0.2:3000"
+	am.AddSeeds([]string{seed})
+	am.Add([]string{other}, 1)
+
+	for i := 0; i < addrMaxFailures; i++ {
+		am.Attempt(seed)
+		am.Attempt(other)
+	}
+	if _, ok := am.addrs[seed]; !ok {
+		t.Error("the seed was removed after failing")
+	}
+	if _, ok := am.addrs[other]; ok {
+		t.Error("the failing address was not removed")
+	}
+
+	//地址表满了以后淘汰其他地址，即使种子节点是最差的
+	var addrs []string
+	for i := 1; i < maxKnownAddresses; i++ {
+		addrs = append(addrs, fmt.Sprintf("10.%d.%d.2:3000", i/256, i%256))
+	}
+	am.Add(addrs, len(addrs))
+	am.Add([]string{"192.168.0.1:3000"}, 1)
+	if _, ok := am.addrs[seed]; !ok {
+		t.Error("the seed was evicted")
+	}
+}
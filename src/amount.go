@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//金额使用定点整数表示，最小单位是一个币的 1/Coin
+//链上和计算中只使用整数，只有在命令行输入输出时才转换成十进制的币数
+type Amount int64
+
+//一个币包含的最小单位数量，即小数点后有8位
+const Coin Amount = 100000000
+const amountDecimals = 8
+
+//货币总量的上限，任何单个输出以及输出的总和都不能超过它
+const MaxMoney = 21000000 * Coin
+
+//判断金额是否在合法范围内
+func MoneyRange(value Amount) bool {
+	return value >= 0 && value <= MaxMoney
+}
+
+//将金额格式化为十进制的币数，去掉小数部分末尾的0，例如 1.2345
+func (a Amount) String() string {
+	sign := ""
+	value := int64(a)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	integer := value / int64(Coin)
+	fraction := value % int64(Coin)
+	if fraction == 0 {
+		return sign + strconv.FormatInt(integer, 10)
+	}
+
+	digits := strconv.FormatInt(fraction, 10)
+	digits = strings.Repeat("0", amountDecimals-len(digits)) + digits
+
+	return sign + strconv.FormatInt(integer, 10) + "." + strings.TrimRight(digits, "0")
+}
+
+//将十进制的币数（例如 "1.2345"）解析成金额
+//不接受负数、超过8位的小数以及超过 MaxMoney 的金额
+func ParseAmount(s string) (Amount, error) {
+	integerPart, fractionPart := s, ""
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		integerPart, fractionPart = s[:dot], s[dot+1:]
+	}
+
+	if integerPart == "" && fractionPart == "" {
+		return 0, errors.New("Amount is empty.")
+	}
+	if len(fractionPart) > amountDecimals {
+		return 0, errors.New("Amount has too many decimal places.")
+	}
+	if !isDigits(integerPart) || !isDigits(fractionPart) {
+		return 0, errors.New("Amount is not a valid decimal number.")
+	}
+
+	//整数部分的位数限制保证后面的乘法不会溢出
+	integerPart = strings.TrimLeft(integerPart, "0")
+	if len(integerPart) > 9 {
+		return 0, errors.New("Amount is out of range.")
+	}
+
+	var integer, fraction int64
+	if integerPart != "" {
+		integer, _ = strconv.ParseInt(integerPart, 10, 64)
+	}
+	if fractionPart != "" {
+		fractionPart += strings.Repeat("0", amountDecimals-len(fractionPart))
+		fraction, _ = strconv.ParseInt(fractionPart, 10, 64)
+	}
+
+	amount := Amount(integer)*Coin + Amount(fraction)
+	if !MoneyRange(amount) {
+		return 0, errors.New("Amount is out of range.")
+	}
+
+	return amount, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
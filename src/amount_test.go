@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	valid := map[string]Amount{
+		"1":                 Coin,
+		"0":                 0,
+		"0.00000001":        1,
+		".5":                Coin / 2,
+		"5.":                5 * Coin,
+		"007.10":            7*Coin + Coin/10,
+		"21000000":          MaxMoney,
+		"20999999.99999999": MaxMoney - 1,
+		"000000000000001":   Coin,
+	}
+	for s, want := range valid {
+		amount, err := ParseAmount(s)
+		if err != nil || amount != want {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d", s, amount, err, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		".",
+		"-1",
+		"+1",
+		" 1",
+		"1e3",
+		"1,5",
+		"1.2.3",
+		"0.000000001",
+		"21000000.00000001",
+		"1000000000",
+		"99999999999999999999",
+	}
+	for _, s := range invalid {
+		if amount, err := ParseAmount(s); err == nil {
+			t.Errorf("ParseAmount(%q) = %d, expected an error", s, amount)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	tests := map[Amount]string{
+		0:             "0",
+		1:             "0.00000001",
+		Coin:          "1",
+		Coin + Coin/4: "1.25",
+		-Coin / 2:     "-0.5",
+		MaxMoney:      "21000000",
+	}
+	for amount, want := range tests {
+		if amount.String() != want {
+			t.Errorf("%d formats as %q, want %q", int64(amount), amount.String(), want)
+		}
+		if amount >= 0 {
+			if parsed, err := ParseAmount(want); err != nil || parsed != amount {
+				t.Errorf("%q parses as %d, %v", want, parsed, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+//节点违反协议时增加违规分数，达到 banscore 后断开连接并禁止它的 IP 连接一段时间
+//禁止列表保存在数据目录的 banlist_<节点 ID>.dat 中，节点重启后仍然有效
+const (
+	misbehaviorMalformed    = 20
+	misbehaviorInvalidTx    = 10
+	misbehaviorInvalidBlock = 100
+	misbehaviorTooManyAddr  = 20
+)
+
+//对方违反协议的错误，处理消息时返回它会增加对方的违规分数
+type Misbehavior struct {
+	Score  int
+	Reason string
+}
+
+func (m *Misbehavior) Error() string {
+	return m.Reason
+}
+
+func misbehaving(score int, format string, args ...interface{}) error {
+	return &Misbehavior{score, fmt.Sprintf(format, args...)}
+}
+
+//一条禁止记录
+type BanEntry struct {
+	Address string
+	Until   time.Time
+	Reason  string
+}
+
+type BanManager struct {
+	mu   sync.Mutex
+	file string
+	bans map[string]BanEntry
+}
+
+//节点运行时使用的禁止列表，由 StartServer 创建
+var banManager = NewBanManager("")
+
+func NewBanManager(file string) *BanManager {
+	return &BanManager{file: file, bans: make(map[string]BanEntry)}
+}
+
+//禁止列表以 IP 为单位，remote 是连接的对方地址
+//对方在 version 中声明的地址可以随意填写，不能用来禁止，本机上的节点共用回环 IP，会一起被禁止
+func banAddress(remote string) string {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return remote
+	}
+
+	return host
+}
+
+//检查 setban 的地址是否是 IP
+func validBanAddress(addr string) bool {
+	return net.ParseIP(addr) != nil
+}
+
+//读取禁止列表，文件不存在或损坏时从空列表开始
+func (bm *BanManager) Load() {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	content, err := ioutil.ReadFile(bm.file)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logWarn("Failed to read %s: %s", bm.file, err)
+		return
+	}
+
+	var bans []BanEntry
+	decoder := gob.NewDecoder(bytes.NewReader(content))
+	err = decoder.Decode(&bans)
+	if err != nil {
+		logWarn("Ignored corrupt ban list %s: %s", bm.file, err)
+		return
+	}
+
+	for _, ban := range bans {
+		bm.bans[ban.Address] = ban
+	}
+}
+
+//禁止列表变化很少，每次变化后立即写入文件
+func (bm *BanManager) save() {
+	if bm.file == "" {
+		return
+	}
+
+	var content bytes.Buffer
+	encoder := gob.NewEncoder(&content)
+	err := encoder.Encode(bm.list())
+	if err != nil {
+		logWarn("Failed to encode ban list: %s", err)
+		return
+	}
+
+	err = writeFileAtomic(bm.file, content.Bytes(), 0600)
+	if err != nil {
+		logWarn("Failed to write %s: %s", bm.file, err)
+	}
+}
+
+//禁止 IP 连接 duration 时间，已经禁止的 IP 更新到期时间
+func (bm *BanManager) Ban(address string, duration time.Duration, reason string) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	bm.bans[address] = BanEntry{address, time.Now().Add(duration), reason}
+	bm.save()
+}
+
+//解除禁止，IP 不在列表中时返回 false
+func (bm *BanManager) Unban(address string) bool {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if _, ok := bm.bans[address]; !ok {
+		return false
+	}
+	delete(bm.bans, address)
+	bm.save()
+
+	return true
+}
+
+func (bm *BanManager) IsBanned(address string) bool {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	ban, ok := bm.bans[address]
+	if !ok {
+		return false
+	}
+	if time.Now().After(ban.Until) {
+		delete(bm.bans, address)
+		bm.save()
+		return false
+	}
+
+	return true
+}
+
+//所有没有到期的禁止记录，按到期时间排序
+func (bm *BanManager) List() []BanEntry {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	return bm.list()
+}
+
+func (bm *BanManager) list() []BanEntry {
+	var bans []BanEntry
+	now := time.Now()
+	for address, ban := range bm.bans {
+		if now.After(ban.Until) {
+			delete(bm.bans, address)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Until.Before(bans[j].Until)
+	})
+
+	return bans
+}
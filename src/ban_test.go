@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBanAddressIsRemoteIP(t *testing.T) {
+	for remote, want := range map[string]string{
+		"127.0.0.1:53211":   "127.0.0.1",
+		"192.0.2.7:3000":    "192.0.2.7",
+		"[2001:db8::1]:443": "2001:db8::1",
+	} {
+		if got := banAddress(remote); got != want {
+			t.Errorf("banAddress(%q) = %q, want %q", remote, got, want)
+		}
+	}
+
+	if validBanAddress("127.0.0.1:3000") || validBanAddress("localhost") || !validBanAddress("2001:db8::1") {
+		t.Error("setban must take a plain IP")
+	}
+}
+
+//被禁止的 IP 连接后不会收到任何消息，不管它会在 version 中声明什么地址
+func TestAcceptRejectsBannedBeforeHandshake(t *testing.T) {
+	saved := banManager
+	banManager = NewBanManager("")
+	defer func() { banManager = saved }()
+	banManager.Ban("127.0.0.1", time.Hour, "test")
+
+	ln, err := net.Listen(protocol, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial(protocol, ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerManager.Accept(conn, nil)
+	if len(peerManager.Peers()) != 0 || peerManager.Connected(conn.RemoteAddr().String()) {
+		t.Error("banned peer was added")
+	}
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := readMessage(client); err == nil {
+		t.Error("banned peer got a message")
+	}
+}
@@ -22,7 +22,11 @@ func Base58Encode(input []byte) []byte {
 		result = append(result, b58Alphabet[mod.Int64()])
 	}
 
-	if input[0] == 0x00 {
+	//每个开头的 0x00 字节编码为一个 1，否则它们在转换成大整数时会丢失
+	for _, b := range input {
+		if b != 0x00 {
+			break
+		}
 		result = append(result, b58Alphabet[0])
 	}
 
@@ -42,9 +46,12 @@ func Base58Decode(input []byte) []byte {
 
 	decoded := result.Bytes()
 
-	if input[0] == b58Alphabet[0] {
-		decoded = append([]byte{0x00}, decoded...)
+	//每个开头的 1 还原为一个 0x00 字节
+	zeros := 0
+	for zeros < len(input) && input[zeros] == b58Alphabet[0] {
+		zeros++
 	}
+	decoded = append(make([]byte, zeros), decoded...)
 
 	return decoded
 }
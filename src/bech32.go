@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//Bech32 (BIP173) 和 Bech32m (BIP350) 编码：人类可读前缀 + 分隔符 1 + 5 位一组的数据 + 6 个字符的校验和
+//只使用小写字母和数字，校验和是 BCH 码，能检测出任意 4 个字符以内的错误
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const bech32Separator = '1'
+const bech32ChecksumLen = 6
+const bech32MaxLen = 90
+
+//两种编码只有校验和的常数不同
+type Bech32Encoding uint32
+
+const (
+	Bech32  Bech32Encoding = 1
+	Bech32m Bech32Encoding = 0x2bc830a3
+)
+
+//地址解码错误，Position 是出错字符在地址中的位置（从 0 开始），无法确定位置时为 -1
+type AddressError struct {
+	Position int
+	Reason   string
+}
+
+func (e *AddressError) Error() string {
+	if e.Position < 0 {
+		return e.Reason + "."
+	}
+
+	return fmt.Sprintf("%s at position %d.", e.Reason, e.Position+1)
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range generator {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+
+	return chk
+}
+
+//校验和同时覆盖人类可读前缀：每个字符的高 3 位、一个 0、每个字符的低 5 位
+func bech32HRPExpand(hrp string) []byte {
+	values := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+
+	return values
+}
+
+func bech32Checksum(hrp string, data []byte, encoding Bech32Encoding) []byte {
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, make([]byte, bech32ChecksumLen)...)
+	polymod := bech32Polymod(values) ^ uint32(encoding)
+
+	checksum := make([]byte, bech32ChecksumLen)
+	for i := range checksum {
+		checksum[i] = byte(polymod>>uint(5*(5-i))) & 31
+	}
+
+	return checksum
+}
+
+//数据和校验和满足哪一种编码，都不满足时返回 0
+func bech32VerifyChecksum(hrp string, data []byte) Bech32Encoding {
+	switch Bech32Encoding(bech32Polymod(append(bech32HRPExpand(hrp), data...))) {
+	case Bech32:
+		return Bech32
+	case Bech32m:
+		return Bech32m
+	}
+
+	return 0
+}
+
+//编码 5 位一组的数据
+func Bech32Encode(hrp string, data []byte, encoding Bech32Encoding) string {
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte(bech32Separator)
+	for _, v := range append(data, bech32Checksum(hrp, data, encoding)...) {
+		sb.WriteByte(bech32Charset[v])
+	}
+
+	return sb.String()
+}
+
+//解码 Bech32 或 Bech32m 字符串，返回小写的人类可读前缀、去掉校验和的数据和编码方式
+//出错时返回 *AddressError，校验和错误只有一个字符写错时能指出它的位置
+func Bech32Decode(s string) (string, []byte, Bech32Encoding, error) {
+	if len(s) > bech32MaxLen {
+		return "", nil, 0, &AddressError{bech32MaxLen, "Address is too long"}
+	}
+
+	lower, upper := -1, -1
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			return "", nil, 0, &AddressError{i, "Invalid character"}
+		}
+		if c >= 'a' && c <= 'z' && lower < 0 {
+			lower = i
+		}
+		if c >= 'A' && c <= 'Z' && upper < 0 {
+			upper = i
+		}
+	}
+	if lower >= 0 && upper >= 0 {
+		//大小写混合时，后出现的那种写法是错误的
+		position := lower
+		if upper > lower {
+			position = upper
+		}
+		return "", nil, 0, &AddressError{position, "Mixed upper and lower case"}
+	}
+	s = strings.ToLower(s)
+
+	separator := strings.LastIndexByte(s, bech32Separator)
+	if separator < 1 {
+		return "", nil, 0, &AddressError{-1, "Missing human-readable prefix or separator"}
+	}
+	if separator+1+bech32ChecksumLen > len(s) {
+		return "", nil, 0, &AddressError{len(s), "Checksum is too short"}
+	}
+
+	hrp := s[:separator]
+	data := make([]byte, 0, len(s)-separator-1)
+	for i := separator + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, 0, &AddressError{i, "Invalid Bech32 character"}
+		}
+		data = append(data, byte(v))
+	}
+
+	encoding := bech32VerifyChecksum(hrp, data)
+	if encoding == 0 {
+		position := locateTypo(s, separator+1, bech32Charset, func(candidate string) bool {
+			values := make([]byte, len(data))
+			for i := range values {
+				values[i] = byte(strings.IndexByte(bech32Charset, candidate[separator+1+i]))
+			}
+			return bech32VerifyChecksum(hrp, values) != 0
+		})
+		return "", nil, 0, &AddressError{position, "Invalid checksum"}
+	}
+
+	return hrp, data[:len(data)-bech32ChecksumLen], encoding, nil
+}
+
+//将 fromBits 位一组的数据转换成 toBits 位一组，pad 为 false 时多余的位必须为 0 并且不超过一组
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxValue := uint32(1)<<toBits - 1
+	var result []byte
+
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, errors.New("Invalid data range.")
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte(acc>>bits&maxValue))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(toBits-bits)&maxValue))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxValue != 0 {
+		return nil, errors.New("Invalid padding.")
+	}
+
+	return result, nil
+}
+
+//校验和错误时，依次把 start 之后的每个字符替换成字母表中的其他字符，
+//只有一个位置的替换能得到有效的字符串时返回这个位置，否则返回 -1
+//地址只有几十个字符，这样的搜索很快，最常见的抄错一个字符的情况都能找到
+func locateTypo(s string, start int, alphabet string, valid func(string) bool) int {
+	found := -1
+	candidate := []byte(s)
+
+	for i := start; i < len(s); i++ {
+		original := candidate[i]
+		for j := 0; j < len(alphabet); j++ {
+			if alphabet[j] == original {
+				continue
+			}
+			candidate[i] = alphabet[j]
+			if valid(string(candidate)) {
+				if found >= 0 && found != i {
+					return -1
+				}
+				found = i
+			}
+		}
+		candidate[i] = original
+	}
+
+	return found
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+//BIP173 和 BIP350 中的有效字符串
+var bech32ValidVectors = []struct {
+	s        string
+	encoding Bech32Encoding
+}{
+	{"A12UEL5L", Bech32},
+	{"a12uel5l", Bech32},
+	{"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs", Bech32},
+	{"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", Bech32},
+	{"11qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqc8247j", Bech32},
+	{"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w", Bech32},
+	{"?1ezyfcl", Bech32},
+	{"A1LQFN3A", Bech32m},
+	{"a1lqfn3a", Bech32m},
+	{"an83characterlonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11sg7hg6", Bech32m},
+	{"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx", Bech32m},
+	{"11llllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllludsr8", Bech32m},
+	{"split1checkupstagehandshakeupstreamerranterredcaperredlc445v", Bech32m},
+	{"?1v759aa", Bech32m},
+}
+
+//BIP173 和 BIP350 中的无效字符串
+var bech32InvalidVectors = []string{
+	//前缀中有超出范围的字符
+	"\x201nwldj5",
+	"\x7f1axkwrx",
+	"\x801eym55h",
+	"\x201xj0phk",
+	"\x7f1g6xzxy",
+	"\x801vctc34",
+	//超过 90 个字符
+	"an84characterslonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1569pvx",
+	"an84characterslonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11d6pts4",
+	//没有分隔符
+	"pzry9x0s0muk",
+	"qyrz8wqd2c9m",
+	//前缀为空
+	"1pzry9x0s0muk",
+	"10a06t8",
+	"1qzzfhee",
+	"1qyrz8wqd2c9m",
+	"16plkw9",
+	"1p2gdwpf",
+	//数据或校验和中有无效字符
+	"x1b4n0q5v",
+	"de1lg7wt\xff",
+	"y1b0jsk6g",
+	"lt1igcx5c0",
+	"mm1crxm3i",
+	"au1s5cgom",
+	//校验和太短
+	"li1dgmt3",
+	"in1muywd",
+	//校验和是用大写的前缀计算的
+	"A1G7SGD8",
+	"M1VUXWEZ",
+}
+
+func TestBech32ValidVectors(t *testing.T) {
+	for _, v := range bech32ValidVectors {
+		hrp, data, encoding, err := Bech32Decode(v.s)
+		if err != nil {
+			t.Errorf("%s: %v", v.s, err)
+			continue
+		}
+		if encoding != v.encoding {
+			t.Errorf("%s: decoded as encoding %x", v.s, encoding)
+		}
+		if encoded := Bech32Encode(hrp, data, encoding); encoded != strings.ToLower(v.s) {
+			t.Errorf("%s: encoded again as %s", v.s, encoded)
+		}
+	}
+}
+
+func TestBech32InvalidVectors(t *testing.T) {
+	for _, s := range bech32InvalidVectors {
+		_, _, _, err := Bech32Decode(s)
+		if _, ok := err.(*AddressError); !ok {
+			t.Errorf("%q: expected an *AddressError, got %v", s, err)
+		}
+	}
+}
+
+//BIP173 和 BIP350 中 bc 前缀的隔离见证地址，只有 20 字节的版本 0 和版本 1 地址是本链的地址
+func TestDecodeAddressSegwitVectors(t *testing.T) {
+	params := *activeNetParams
+	params.Bech32HRP = "bc"
+	saved := activeNetParams
+	activeNetParams = &params
+	defer func() { activeNetParams = saved }()
+
+	pubKeyHash, err := DecodeAddress("BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pubKeyHash, decodeHex(t, "751e76e8199196d454941c45d1b3a323f1433bd6")) {
+		t.Errorf("public key hash is %x", pubKeyHash)
+	}
+	if encodeBech32Address(witnessVersionECDSA, pubKeyHash) != "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4" {
+		t.Error("address is not encoded again")
+	}
+
+	invalid := []struct{ address, reason string }{
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh", "must use Bech32"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd", "must use Bech32m"},
+		{"BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL", "Unsupported witness version"},
+		{"BC1SW50QGDZ25J", "Unsupported witness version"},
+		{"bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", "Unsupported witness version"},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", "invalid length"},
+		{"BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P", "invalid length"},
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5", "Invalid checksum"},
+		{"bc1gmk9yu", "Missing witness version"},
+		{"bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4", "Invalid Bech32 character"},
+	}
+	for _, v := range invalid {
+		_, err := DecodeAddress(v.address)
+		expectError(t, err, v.reason)
+	}
+}
+
+func TestBech32AddressRoundTrip(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeP256, KeyTypeSecp256k1, KeyTypeSchnorr} {
+		wallet := NewWalletWithKeyType(keyType)
+		pubKeyHash := HashPubKey(wallet.PublicKey)
+		address := string(wallet.GetBech32Address())
+
+		for _, s := range []string{address, strings.ToUpper(address), string(wallet.GetAddress())} {
+			decoded, err := DecodeAddress(s)
+			if err != nil {
+				t.Errorf("%s: %v", s, err)
+			} else if !bytes.Equal(decoded, pubKeyHash) {
+				t.Errorf("%s: decoded as %x", s, decoded)
+			}
+		}
+		if normalizeAddress(address) != string(wallet.GetAddress()) {
+			t.Errorf("%s is not normalized to the Base58Check address", address)
+		}
+
+		//改动一个字符时能指出它的位置
+		typo := []byte(address)
+		position := len(activeNetParams.Bech32HRP) + 3
+		if typo[position] == 'q' {
+			typo[position] = 'p'
+		} else {
+			typo[position] = 'q'
+		}
+		_, err := DecodeAddress(string(typo))
+		if e, ok := err.(*AddressError); !ok || e.Position != position {
+			t.Errorf("typo at %d in %s: %v", position, typo, err)
+		}
+	}
+}
@@ -60,13 +60,23 @@ func (b *Block) Serialize() []byte {
 
 //从byte array转换到Go struct
 func DeserializeBlock(d []byte) *Block {
+	block, err := ParseBlock(d)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return block
+}
+
+//解析其他节点发来的块，格式错误时返回错误
+func ParseBlock(d []byte) (*Block, error) {
 	var block Block
 
 	decoder := gob.NewDecoder(bytes.NewReader(d))
 	err := decoder.Decode(&block)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	return &block
+	return &block, nil
 }
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -17,9 +16,7 @@ import (
 //为了获取一个值，你需要知道一个bucket和一个key
 //BoltDB没有数据类型，键和值都是byte array
 //在BoltDB中，有两种形式的事务：1.db.Update()：读写事务  2.db.View()：只读事务
-const dbFile = "blockchain_%s.db"
 const blocksBucket = "blocks"
-const genesisCoinbaseData = "The Times 18/Api/2018 Chancellor on brink of second bailout for banks"
 
 type Blockchain struct {
 	tip []byte
@@ -28,7 +25,7 @@ type Blockchain struct {
 
 //创建区块链
 func CreateBlockchain(address, nodeID string) *Blockchain {
-	dbFile := fmt.Sprintf(dbFile, nodeID)
+	dbFile := dbPath(nodeID)
 	//如果区块链已存在，则返回
 	if dbExists(dbFile) {
 		fmt.Println("Blockchain already exists.")
@@ -38,7 +35,7 @@ func CreateBlockchain(address, nodeID string) *Blockchain {
 	var tip []byte
 
 	//创建区块链，首先要先创建一个Coinbase交易，然后基于此交易创建一个创世区块
-	cbtx := NewCoinbaseTX(address, genesisCoinbaseData)
+	cbtx := NewCoinbaseTX(address, activeNetParams.GenesisCoinbaseData)
 	genesis := NewGenesisBlock(cbtx)
 
 	//打开要存放区块链的DB
@@ -80,7 +77,7 @@ func CreateBlockchain(address, nodeID string) *Blockchain {
 //2.如果存在，打开DB
 //3.获取存储区块的bucket，并将1键更新为存储连中的最后一个块的hash
 func NewBlockchain(nodeID string) *Blockchain {
-	dbFile := fmt.Sprintf(dbFile, nodeID)
+	dbFile := dbPath(nodeID)
 	if dbExists(dbFile) == false {
 		fmt.Println("No existing blockchain found. Create one first.")
 		os.Exit(1)
@@ -94,7 +91,8 @@ func NewBlockchain(nodeID string) *Blockchain {
 
 	err = db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
-		tip = b.Get([]byte("1"))
+		//bolt 返回的值只在事务内有效，需要复制一份
+		tip = append([]byte{}, b.Get([]byte("1"))...)
 
 		return nil
 	})
@@ -104,6 +102,12 @@ func NewBlockchain(nodeID string) *Blockchain {
 
 	bc := Blockchain{tip, db}
 
+	UTXOSet := UTXOSet{&bc}
+	if UTXOSet.NeedsReindex() {
+		fmt.Println("The UTXO set was written by an older version, rebuilding it...")
+		UTXOSet.Reindex()
+	}
+
 	return &bc
 }
 
@@ -193,8 +197,11 @@ func (bc *Blockchain) FindUTXO() map[string]TXOutputs {
 				}
 
 				//增加现在不存在的TXOutputs
-				outs := UTXO[txID]
-				outs.Outputs = append(outs.Outputs, out)
+				outs, ok := UTXO[txID]
+				if !ok {
+					outs = TXOutputs{make(map[int]TXOutput), block.Height, tx.IsCoinbase()}
+				}
+				outs.Outputs[outIdx] = out
 				UTXO[txID] = outs
 			}
 
@@ -215,6 +222,28 @@ func (bc *Blockchain) FindUTXO() map[string]TXOutputs {
 	return UTXO
 }
 
+//找到所有在链上出现过的公钥哈希，已经花费的输出也算在内，用于恢复 HD 钱包
+func (bc *Blockchain) FindUsedPubKeyHashes() map[string]bool {
+	used := make(map[string]bool)
+	bci := bc.Iterator()
+
+	for {
+		block := bci.Next()
+
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Vout {
+				used[hex.EncodeToString(out.PubKeyHash)] = true
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return used
+}
+
 //区块链的迭代
 //迭代器的初始状态为链中的tip，因此区块将从尾到头进行获取
 func (bc *Blockchain) Iterator() *BlockchainIterator {
@@ -289,16 +318,9 @@ func (bc *Blockchain) MineBlock(transactions []*Transaction) *Block {
 	var lastHash []byte
 	var lastHeight int
 
-	//遍历验证交易集中的交易均为有效交易
-	for _, tx := range transactions {
-		if bc.VerifyTransaction(tx) != true {
-			log.Panic("ERROR: Invalid transaction")
-		}
-	}
-
 	err := bc.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
-		lastHash = b.Get([]byte("l"))
+		lastHash = append([]byte{}, b.Get([]byte("1"))...)
 
 		blockData := b.Get(lastHash)
 		block := DeserializeBlock(blockData)
@@ -311,6 +333,12 @@ func (bc *Blockchain) MineBlock(transactions []*Transaction) *Block {
 		log.Panic(err)
 	}
 
+	//验证交易集中的交易均符合共识规则
+	err = CheckBlockTransactions(transactions, UTXOSet{bc}, lastHeight+1)
+	if err != nil {
+		log.Panic("ERROR: Invalid transaction: ", err)
+	}
+
 	newBlock := NewBlock(transactions, lastHash, lastHeight+1)
 
 	err = bc.db.Update(func(tx *bolt.Tx) error {
@@ -320,7 +348,7 @@ func (bc *Blockchain) MineBlock(transactions []*Transaction) *Block {
 			log.Panic(err)
 		}
 
-		err = b.Put([]byte("l"), newBlock.Hash)
+		err = b.Put([]byte("1"), newBlock.Hash)
 		if err != nil {
 			log.Panic(err)
 		}
@@ -338,7 +366,7 @@ func (bc *Blockchain) MineBlock(transactions []*Transaction) *Block {
 
 //传入一笔交易，找到它引用的交易，然后对它进行数字签名
 //数字签名的过程就是在区块链中找到交易，并对其中所有TXInput进行privKey的签名
-func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) {
+func (bc *Blockchain) SignTransaction(tx *Transaction, signer Signer) {
 	prevTXs := make(map[string]Transaction)
 
 	for _, vin := range tx.Vin {
@@ -350,10 +378,10 @@ func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey)
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	tx.Sign(privKey, prevTXs)
+	tx.Sign(signer, prevTXs)
 }
 
-//验证交易有效性
+//验证交易的签名，coinbase 的成熟度由 CheckTxInputs 检查
 func (bc *Blockchain) VerifyTransaction(tx *Transaction) bool {
 	//Coinbase为有效交易
 	if tx.IsCoinbase() {
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+//一个网络的全部参数，不同网络的区块链、地址、私钥和 P2P 消息互不兼容
+//Magic 放在每条 P2P 消息的开头，节点收到其他网络的消息时直接丢弃
+//CoinbaseMaturity 是 coinbase 交易的成熟深度：奖励输出要等到之后第 CoinbaseMaturity 个区块才能被花费
+//DBFile、WalletFile、PeersFile、BanListFile 和 RPCCookieFile 中的 %s 是节点 ID，不同网络的数据保存在不同的文件中
+type ChainParams struct {
+	Name                string
+	Magic               [4]byte
+	GenesisCoinbaseData string
+	AddressVersion      byte
+	PrivKeyVersion      byte
+	Bech32HRP           string
+	TargetBits          int
+	Subsidy             Amount
+	CoinbaseMaturity    int
+	SeedNodes           []string
+	DBFile              string
+	WalletFile          string
+	PeersFile           string
+	BanListFile         string
+	RPCCookieFile       string
+}
+
+//主网：与之前版本的常量相同，已有的区块链、钱包和地址可以继续使用
+var MainNetParams = ChainParams{
+	Name:                "main",
+	Magic:               [4]byte{0xf9, 0xbe, 0xb4, 0xd9},
+	GenesisCoinbaseData: "The Times 18/Api/2018 Chancellor on brink of second bailout for banks",
+	AddressVersion:      0x00,
+	PrivKeyVersion:      0x80,
+	Bech32HRP:           "bgo",
+	TargetBits:          16,
+	Subsidy:             10 * Coin,
+	CoinbaseMaturity:    100,
+	SeedNodes:           []string{"localhost:3000"},
+	DBFile:              "blockchain_%s.db",
+	WalletFile:          "wallet_%s.dat",
+	PeersFile:           "peers_%s.dat",
+	BanListFile:         "banlist_%s.dat",
+	RPCCookieFile:       "rpc_%s.cookie",
+}
+
+//测试网：难度较低，地址以 m 或 n 开头
+var TestNetParams = ChainParams{
+	Name:                "testnet",
+	Magic:               [4]byte{0x0b, 0x11, 0x09, 0x07},
+	GenesisCoinbaseData: "BlockChain_Go testnet genesis block",
+	AddressVersion:      0x6f,
+	PrivKeyVersion:      0xef,
+	Bech32HRP:           "tbgo",
+	TargetBits:          12,
+	Subsidy:             10 * Coin,
+	CoinbaseMaturity:    100,
+	SeedNodes:           []string{"localhost:4000"},
+	DBFile:              "blockchain_testnet_%s.db",
+	WalletFile:          "wallet_testnet_%s.dat",
+	PeersFile:           "peers_testnet_%s.dat",
+	BanListFile:         "banlist_testnet_%s.dat",
+	RPCCookieFile:       "rpc_testnet_%s.cookie",
+}
+
+//回归测试网络：本地测试用，难度为 0，任何哈希都满足目标，generate 命令可以立即挖出区块
+//coinbase 奖励只需要 10 个区块就能花费
+var RegTestParams = ChainParams{
+	Name:                "regtest",
+	Magic:               [4]byte{0xfa, 0xbf, 0xb5, 0xda},
+	GenesisCoinbaseData: "BlockChain_Go regtest genesis block",
+	AddressVersion:      0x6f,
+	PrivKeyVersion:      0xef,
+	Bech32HRP:           "bgort",
+	TargetBits:          0,
+	Subsidy:             10 * Coin,
+	CoinbaseMaturity:    10,
+	SeedNodes:           []string{"localhost:5000"},
+	DBFile:              "blockchain_regtest_%s.db",
+	WalletFile:          "wallet_regtest_%s.dat",
+	PeersFile:           "peers_regtest_%s.dat",
+	BanListFile:         "banlist_regtest_%s.dat",
+	RPCCookieFile:       "rpc_regtest_%s.cookie",
+}
+
+var chainParams = map[string]*ChainParams{
+	MainNetParams.Name: &MainNetParams,
+	TestNetParams.Name: &TestNetParams,
+	RegTestParams.Name: &RegTestParams,
+}
+
+const defaultNetwork = "main"
+
+//当前使用的网络，由配置文件的 network 或命令行的 -network 参数选择
+var activeNetParams = &MainNetParams
+
+//切换当前网络，已知节点重置为该网络的种子节点
+func SelectNetwork(name string) error {
+	params, ok := chainParams[name]
+	if !ok {
+		return fmt.Errorf("Unknown network %q, use one of %v.", name, networkNames())
+	}
+
+	activeNetParams = params
+	knownNodes = append([]string(nil), params.SeedNodes...)
+
+	return nil
+}
+
+func networkNames() []string {
+	var names []string
+	for name := range chainParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
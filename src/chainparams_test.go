@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+//不同网络的参数不能有相同的值，否则数据和消息可能被另一个网络接受
+func TestNetworkParamsAreDistinct(t *testing.T) {
+	seen := make(map[string]string)
+	for name, params := range chainParams {
+		if params.Name != name {
+			t.Errorf("network %s is registered as %s", params.Name, name)
+		}
+
+		for _, value := range []string{string(params.Magic[:]), params.GenesisCoinbaseData, params.Bech32HRP, params.DBFile, params.WalletFile, params.PeersFile, params.BanListFile, params.RPCCookieFile} {
+			if other, ok := seen[value]; ok {
+				t.Errorf("%s and %s share %q", name, other, value)
+			}
+			seen[value] = name
+		}
+	}
+}
+
+func TestSelectNetwork(t *testing.T) {
+	defer SelectNetwork(defaultNetwork)
+
+	if err := SelectNetwork("testnet"); err != nil {
+		t.Fatal(err)
+	}
+	if activeNetParams != &TestNetParams || len(knownNodes) != 1 || knownNodes[0] != TestNetParams.SeedNodes[0] {
+		t.Errorf("network %s with seeds %v", activeNetParams.Name, knownNodes)
+	}
+
+	expectError(t, SelectNetwork("simnet"), "Unknown network")
+	if activeNetParams != &TestNetParams {
+		t.Error("an unknown network changed the active network")
+	}
+}
+
+func TestAddressesAreNetworkSpecific(t *testing.T) {
+	defer SelectNetwork(defaultNetwork)
+
+	SelectNetwork("testnet")
+	wallet := NewWallet()
+	base58 := string(wallet.GetAddress())
+	bech32 := string(wallet.GetBech32Address())
+	if _, err := DecodeAddress(base58); err != nil {
+		t.Fatal(err)
+	}
+
+	SelectNetwork("main")
+	if _, err := DecodeAddress(base58); err == nil {
+		t.Error("testnet Base58Check address accepted on main")
+	}
+	if _, err := DecodeAddress(bech32); err == nil {
+		t.Error("testnet Bech32 address accepted on main")
+	}
+}
+
+func TestMessagesFromOtherNetworkAreRejected(t *testing.T) {
+	defer SelectNetwork(defaultNetwork)
+
+	SelectNetwork("regtest")
+	var buff bytes.Buffer
+	if err := writeMessage(&buff, "ping", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	SelectNetwork("main")
+	if _, err := readMessage(&buff); err != errMessageMagic {
+		t.Errorf("expected errMessageMagic, got %v", err)
+	}
+}
@@ -1,98 +1,359 @@
 package main
 
 import (
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"golang.org/x/term"
 	"log"
+	"math"
 	"os"
+	"runtime"
 	"strconv"
+	"time"
 )
 
 type CLI struct{}
 
 //脚本的使用说明
 func (cli *CLI) printUsage() {
-	fmt.Println("Usage:")
+	fmt.Println("Usage: [GLOBAL OPTIONS] COMMAND [OPTIONS]")
+	fmt.Println("Global options override the config file, which overrides the defaults. The NODE_ID env. var. is used, when -nodeid is not set")
+	fmt.Println("  -conf FILE - Read the config from FILE instead of blockchain.conf in the data directory")
+	fmt.Println("  -datadir DIR - Keep the blockchain, wallet and config files in DIR, the current directory by default")
+	fmt.Println("  -network NETWORK - Use the main (default), testnet or regtest network. Each network has its own blockchain and wallet files")
+	fmt.Println("  -nodeid ID - Node ID used in the file names, the port of -listen by default")
+	fmt.Println("  -listen ADDRESS - Listen for other nodes on ADDRESS, localhost:<node ID> by default")
+	fmt.Println("  -external ADDRESS - Announce ADDRESS to other nodes, the listen address by default")
+	fmt.Println("  -seeds ADDRESSES - Comma separated seed nodes, replacing the network's default seed")
+	fmt.Println("  -rpclisten ADDRESS - Serve RPC on ADDRESS, localhost:<node ID + 10000> by default. -rpc=false disables the RPC server")
+	fmt.Println("  -rpcpassword PASSWORD - Require PASSWORD from RPC clients instead of the cookie file the node writes to the data directory. Needed for a -rpclisten address that is not on loopback")
+	fmt.Println("  -loglevel LEVEL - Print node logs of LEVEL and above: debug, info (default), warn or error")
+	fmt.Println("  -banscore SCORE - Disconnect and ban a peer when its misbehavior score reaches SCORE, 100 by default")
+	fmt.Println("  -bantime SECONDS - Ban misbehaving peers for SECONDS, one day by default")
 	fmt.Println("  createblockchain -address ADDRESS - Create a blockchain and send genesis block reward to ADDRESS")
-	fmt.Println("  createwallet - Generates a new key-pair and saves it into the wallet file")
-	fmt.Println("  getbalance -address ADDRESS - Get balance of ADDRESS")
-	fmt.Println("  listaddresses - Lists all addresses from the wallet file")
+	fmt.Println("  createrawtx -from FROM -to TO -amount AMOUNT | -file FILE -coinselect STRATEGY -out PSBT - Create an unsigned transaction without touching any private key")
+	fmt.Println("  changepassphrase - Re-encrypts the wallet file with a new passphrase")
+	fmt.Println("  dumpprivkey -address ADDRESS - Prints the private key of ADDRESS in Base58Check encoding")
+	fmt.Println("  dumpwallet -file FILE - Writes all keys of the wallet to a new text FILE for backup and migration")
+	fmt.Println("  encryptwallet - Encrypts an existing plaintext wallet file with a passphrase")
+	fmt.Println("  createwallet -keytype TYPE -count N -bech32 - Generates N new key-pairs and saves them into the wallet file in one write. Print the addresses in Bech32 format, when -bech32 is set. A new wallet file is derived from a mnemonic that is printed once. HD addresses are refused when more than 20 would be unused in a row, restorewallet would not find them. TYPE is p256 (default), secp256k1 or schnorr")
+	fmt.Println("  generate -blocks N -address ADDRESS - Mine N blocks immediately with the rewards to ADDRESS, including the valid mempool transactions of the running node. Blocks are instant on regtest")
+	fmt.Println("  getbalance -address ADDRESS - Get spendable and immature balance of ADDRESS. Marks watch-only addresses of an unencrypted wallet")
+	fmt.Println("  getwalletbalance - Get confirmed, unconfirmed and immature balance of all addresses in the wallet")
+	fmt.Println("  importaddress -address ADDRESS -rescan - Watch ADDRESS without its private key. Scan the blockchain for it, when -rescan is set")
+	fmt.Println("  importprivkey -privkey PRIVKEY - Adds the private key printed by dumpprivkey to the wallet")
+	fmt.Println("  importpubkey -pubkey PUBKEY -rescan - Watch the address of the hex encoded PUBKEY without its private key")
+	fmt.Println("  importwallet -file FILE - Imports the keys of a FILE written by dumpwallet")
+	fmt.Println("  listbanned - Lists the IP addresses banned by the running node and when the bans expire")
+	fmt.Println("  listaddresses -bech32 - Lists all addresses from the wallet file, watch-only addresses are marked. Print them in Bech32 format, when -bech32 is set")
+	fmt.Println("  listtransactions - Lists the transactions of the wallet with received and sent amounts, fees and confirmations")
+	fmt.Println("  listunspent -minconf MIN -maxconf MAX - Lists unspent outputs of the wallet with MIN to MAX confirmations")
 	fmt.Println("  printchain - Print all the blocks of the blockchain")
 	fmt.Println("  reindexutxo - Rebuilds the UTXO set")
-	fmt.Println("  send -from FROM -to TO -amount AMOUNT -mine - Send AMOUNT of coins from FROM address to TO. Mine on the same node, when -mine is set.")
-	fmt.Println("  startnode -miner ADDRESS - Start a node with ID specified in NODE_ID env. var. -miner enables mining")
+	fmt.Println("  restorewallet -mnemonic MNEMONIC - Restores the wallet file from MNEMONIC and rescans the blockchain for used addresses")
+	fmt.Println("  sendrawtx -in PSBT -miner ADDRESS - Broadcast a fully signed transaction. Mine it on the same node and reward ADDRESS, when -miner is set")
+	fmt.Println("  setban -ip IP -remove -duration SECONDS - Bans IP on the running node for SECONDS and disconnects it, the -bantime by default. Lifts the ban, when -remove is set")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT -coinselect STRATEGY -mine -rpc - Send AMOUNT of coins from FROM address to TO. Mine on the same node, when -mine is set. Sign with the running node's unlocked wallet, when -rpc is set. STRATEGY is bnb (default), largest, smallest or random")
+	fmt.Println("  sendmany -from FROM -file FILE -coinselect STRATEGY -mine - Pay every ADDRESS,AMOUNT pair in the CSV or JSON FILE with one transaction")
+	fmt.Println("  signrawtx -in PSBT -out PSBT - Sign the inputs of PSBT that belong to the wallet file, no blockchain needed")
+	fmt.Println("  signmessage -address ADDRESS -message MESSAGE - Sign MESSAGE with the key of ADDRESS to prove control of it without moving funds")
+	fmt.Println("  verifymessage -address ADDRESS -signature SIGNATURE -message MESSAGE - Check that SIGNATURE of MESSAGE was made by the key of ADDRESS")
+	fmt.Println("  vanityaddress -prefix PREFIX -keytype TYPE -workers N - Searches random keys on N cores until the address starts with PREFIX and adds it to the wallet")
+	fmt.Println("  walletlock - Locks the wallet of the running node")
+	fmt.Println("  walletpassphrase -timeout SECONDS - Unlocks the wallet of the running node for SECONDS. The node loads no wallet, not even a plaintext one, before this")
+	fmt.Println("  startnode -miner ADDRESS - Start a node with the configured ID and addresses. -miner enables mining, the miner address of the config file by default")
 }
 
-func (cli *CLI) validateArgs() {
-	if len(os.Args) < 2 {
+func (cli *CLI) validateArgs(args []string) {
+	if len(args) < 1 {
 		cli.printUsage()
 		os.Exit(1)
 	}
 }
 
 func (cli *CLI) Run() {
-	cli.validateArgs()
+	//命令之前的全局参数
+	globalFlags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	globalFlags.Usage = cli.printUsage
+	confFile := globalFlags.String("conf", "", "Config file, "+defaultConfigFile+" in the data directory by default")
+	globalFlags.String("network", defaultNetwork, "Network to use: main, testnet or regtest")
+	globalFlags.String("datadir", ".", "Directory of the blockchain, wallet and config files")
+	globalFlags.String("nodeid", "", "Node ID, overrides the NODE_ID env. var.")
+	globalFlags.String("listen", "", "Address to listen on for other nodes, localhost:<node ID> by default")
+	globalFlags.String("external", "", "Address announced to other nodes, the listen address by default")
+	globalFlags.String("seeds", "", "Comma separated addresses of the seed nodes")
+	globalFlags.String("rpclisten", "", "Address of the RPC server, localhost:<node ID + 10000> by default")
+	globalFlags.Bool("rpc", true, "Start the RPC server with the node")
+	globalFlags.String("rpcpassword", "", "Password of the RPC server, a random cookie in the data directory by default")
+	globalFlags.String("loglevel", defaultLogLevel, "Log level: debug, info, warn or error")
+	globalFlags.Int("banscore", defaultBanScore, "Misbehavior score at which a peer is banned")
+	globalFlags.Int("bantime", int(defaultBanTime/time.Second), "Seconds to ban a misbehaving peer")
+	err := globalFlags.Parse(os.Args[1:])
+	if err != nil {
+		log.Panic(err)
+	}
+	args := globalFlags.Args()
+	cli.validateArgs(args)
 
-	nodeID := os.Getenv("NODE_ID")
-	if nodeID == "" {
-		fmt.Printf("NODE_ID env. var is not set!")
+	//只有命令行上出现过的参数才覆盖配置文件
+	flags := make(map[string]string)
+	globalFlags.Visit(func(f *flag.Flag) {
+		if f.Name != "conf" {
+			flags[f.Name] = f.Value.String()
+		}
+	})
+	cfg, err := LoadConfig(*confFile, flags)
+	if err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
+	cfg.Apply()
+	nodeID := cfg.NodeID
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+	changePassphraseCmd := flag.NewFlagSet("changepassphrase", flag.ExitOnError)
+	walletPassphraseCmd := flag.NewFlagSet("walletpassphrase", flag.ExitOnError)
+	walletLockCmd := flag.NewFlagSet("walletlock", flag.ExitOnError)
+	getWalletBalanceCmd := flag.NewFlagSet("getwalletbalance", flag.ExitOnError)
+	listUnspentCmd := flag.NewFlagSet("listunspent", flag.ExitOnError)
+	listTransactionsCmd := flag.NewFlagSet("listtransactions", flag.ExitOnError)
+	dumpPrivKeyCmd := flag.NewFlagSet("dumpprivkey", flag.ExitOnError)
+	importPrivKeyCmd := flag.NewFlagSet("importprivkey", flag.ExitOnError)
+	dumpWalletCmd := flag.NewFlagSet("dumpwallet", flag.ExitOnError)
+	importWalletCmd := flag.NewFlagSet("importwallet", flag.ExitOnError)
+	importAddressCmd := flag.NewFlagSet("importaddress", flag.ExitOnError)
+	importPubKeyCmd := flag.NewFlagSet("importpubkey", flag.ExitOnError)
+	createRawTxCmd := flag.NewFlagSet("createrawtx", flag.ExitOnError)
+	signRawTxCmd := flag.NewFlagSet("signrawtx", flag.ExitOnError)
+	sendRawTxCmd := flag.NewFlagSet("sendrawtx", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	listBannedCmd := flag.NewFlagSet("listbanned", flag.ExitOnError)
+	setBanCmd := flag.NewFlagSet("setban", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
 	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
+	vanityAddressCmd := flag.NewFlagSet("vanityaddress", flag.ExitOnError)
+	generateCmd := flag.NewFlagSet("generate", flag.ExitOnError)
+	signMessageCmd := flag.NewFlagSet("signmessage", flag.ExitOnError)
+	verifyMessageCmd := flag.NewFlagSet("verifymessage", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	sendManyCmd := flag.NewFlagSet("sendmany", flag.ExitOnError)
 	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
-	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendAmount := sendCmd.String("amount", "", "Amount of coins to send, e.g. 1.2345")
 	sendMine := sendCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendCoinSelect := sendCmd.String("coinselect", defaultCoinSelector, "Coin selection strategy: bnb, largest, smallest or random")
+	sendRPC := sendCmd.Bool("rpc", false, "Sign and broadcast with the running node's unlocked wallet")
+	walletPassphraseTimeout := walletPassphraseCmd.Int("timeout", 60, "Seconds to keep the wallet unlocked")
+	sendManyFrom := sendManyCmd.String("from", "", "Source wallet address")
+	sendManyFile := sendManyCmd.String("file", "", "CSV or JSON file with ADDRESS,AMOUNT pairs")
+	sendManyMine := sendManyCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendManyCoinSelect := sendManyCmd.String("coinselect", defaultCoinSelector, "Coin selection strategy: bnb, largest, smallest or random")
+	createRawTxFrom := createRawTxCmd.String("from", "", "Source wallet address")
+	createRawTxTo := createRawTxCmd.String("to", "", "Destination wallet address")
+	createRawTxAmount := createRawTxCmd.String("amount", "", "Amount of coins to send, e.g. 1.2345")
+	createRawTxFile := createRawTxCmd.String("file", "", "CSV or JSON file with ADDRESS,AMOUNT pairs, instead of -to and -amount")
+	createRawTxCoinSelect := createRawTxCmd.String("coinselect", defaultCoinSelector, "Coin selection strategy: bnb, largest, smallest or random")
+	createRawTxOut := createRawTxCmd.String("out", "", "File to write the PSBT to, printed when empty")
+	signRawTxIn := signRawTxCmd.String("in", "", "File to read the PSBT from")
+	signRawTxOut := signRawTxCmd.String("out", "", "File to write the signed PSBT to, printed when empty")
+	sendRawTxIn := sendRawTxCmd.String("in", "", "File to read the signed PSBT from")
+	sendRawTxMiner := sendRawTxCmd.String("miner", "", "Mine immediately on the same node and send reward to ADDRESS")
+	listUnspentMinConf := listUnspentCmd.Int("minconf", 1, "Minimum confirmations, 0 includes the running node's mempool")
+	listUnspentMaxConf := listUnspentCmd.Int("maxconf", 9999999, "Maximum confirmations")
+	dumpPrivKeyAddress := dumpPrivKeyCmd.String("address", "", "The address to export the private key of")
+	importPrivKeyPrivKey := importPrivKeyCmd.String("privkey", "", "The private key printed by dumpprivkey")
+	dumpWalletFile := dumpWalletCmd.String("file", "", "The file to write the wallet dump to")
+	importWalletFile := importWalletCmd.String("file", "", "The wallet dump to import")
+	importAddressAddress := importAddressCmd.String("address", "", "The address to watch")
+	importAddressRescan := importAddressCmd.Bool("rescan", false, "Scan the blockchain for the address")
+	importPubKeyPubKey := importPubKeyCmd.String("pubkey", "", "The hex encoded public key to watch")
+	importPubKeyRescan := importPubKeyCmd.Bool("rescan", false, "Scan the blockchain for the address")
+	createWalletKeyType := createWalletCmd.String("keytype", defaultKeyType, "Signature scheme: p256, secp256k1 or schnorr")
+	createWalletCount := createWalletCmd.Int("count", 1, "Number of addresses to generate")
+	createWalletBech32 := createWalletCmd.Bool("bech32", false, "Print the addresses in Bech32 format")
+	listAddressesBech32 := listAddressesCmd.Bool("bech32", false, "Print the addresses in Bech32 format")
+	vanityAddressPrefix := vanityAddressCmd.String("prefix", "", "The Base58 prefix the address must start with, e.g. 1Bob")
+	vanityAddressKeyType := vanityAddressCmd.String("keytype", defaultKeyType, "Signature scheme: p256, secp256k1 or schnorr")
+	vanityAddressWorkers := vanityAddressCmd.Int("workers", runtime.NumCPU(), "Number of parallel searches")
+	signMessageAddress := signMessageCmd.String("address", "", "The address whose key signs the message")
+	signMessageMessage := signMessageCmd.String("message", "", "The message to sign")
+	verifyMessageAddress := verifyMessageCmd.String("address", "", "The address that signed the message")
+	verifyMessageSignature := verifyMessageCmd.String("signature", "", "The signature printed by signmessage")
+	verifyMessageMessage := verifyMessageCmd.String("message", "", "The signed message")
+	generateBlockCount := generateCmd.Int("blocks", 1, "Number of blocks to mine")
+	generateAddress := generateCmd.String("address", "", "The address to send the block rewards to")
+	setBanIP := setBanCmd.String("ip", "", "The IP address to ban")
+	setBanRemove := setBanCmd.Bool("remove", false, "Lift the ban of the IP address")
+	setBanDuration := setBanCmd.Int("duration", 0, "Seconds to ban the IP address, the -bantime by default")
+	restoreWalletMnemonic := restoreWalletCmd.String("mnemonic", "", "The mnemonic printed when the wallet was created")
 	startNodeMiner := startNodeCmd.String("miner", "", "Enable mining mode and send reward to ADDRESS")
 
-	switch os.Args[1] {
+	switch args[0] {
 	case "getbalance":
-		err := getBalanceCmd.Parse(os.Args[2:])
+		err := getBalanceCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "createblockchain":
-		err := createBlockchainCmd.Parse(os.Args[2:])
+		err := createBlockchainCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "createwallet":
-		err := createWalletCmd.Parse(os.Args[2:])
+		err := createWalletCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "encryptwallet":
+		err := encryptWalletCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "changepassphrase":
+		err := changePassphraseCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "walletpassphrase":
+		err := walletPassphraseCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "walletlock":
+		err := walletLockCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getwalletbalance":
+		err := getWalletBalanceCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "listunspent":
+		err := listUnspentCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "listtransactions":
+		err := listTransactionsCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "dumpprivkey":
+		err := dumpPrivKeyCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importprivkey":
+		err := importPrivKeyCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "dumpwallet":
+		err := dumpWalletCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importwallet":
+		err := importWalletCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importaddress":
+		err := importAddressCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importpubkey":
+		err := importPubKeyCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createrawtx":
+		err := createRawTxCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signrawtx":
+		err := signRawTxCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "sendrawtx":
+		err := sendRawTxCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "listaddresses":
-		err := listAddressesCmd.Parse(os.Args[2:])
+		err := listAddressesCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "listbanned":
+		err := listBannedCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "setban":
+		err := setBanCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "printchain":
-		err := printChainCmd.Parse(os.Args[2:])
+		err := printChainCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "reindexutxo":
-		err := reindexUTXOCmd.Parse(os.Args[2:])
+		err := reindexUTXOCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "vanityaddress":
+		err := vanityAddressCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signmessage":
+		err := signMessageCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifymessage":
+		err := verifyMessageCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "generate":
+		err := generateCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "restorewallet":
+		err := restoreWalletCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "send":
-		err := sendCmd.Parse(os.Args[2:])
+		err := sendCmd.Parse(args[1:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "sendmany":
+		err := sendManyCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
 	case "startnode":
-		err := startNodeCmd.Parse(os.Args[2:])
+		err := startNodeCmd.Parse(args[1:])
 		if err != nil {
 			log.Panic(err)
 		}
@@ -118,11 +379,187 @@ func (cli *CLI) Run() {
 	}
 
 	if createWalletCmd.Parsed() {
-		cli.createWallet(nodeID)
+		keyType, err := ParseKeyType(*createWalletKeyType)
+		if err != nil || *createWalletCount <= 0 {
+			createWalletCmd.Usage()
+			os.Exit(1)
+		}
+		cli.createWallet(keyType, *createWalletCount, *createWalletBech32, nodeID)
+	}
+
+	if vanityAddressCmd.Parsed() {
+		keyType, err := ParseKeyType(*vanityAddressKeyType)
+		if err != nil || *vanityAddressPrefix == "" || *vanityAddressWorkers <= 0 {
+			vanityAddressCmd.Usage()
+			os.Exit(1)
+		}
+		cli.vanityAddress(*vanityAddressPrefix, keyType, *vanityAddressWorkers, nodeID)
+	}
+
+	if signMessageCmd.Parsed() {
+		if *signMessageAddress == "" {
+			signMessageCmd.Usage()
+			os.Exit(1)
+		}
+		cli.signMessage(*signMessageAddress, *signMessageMessage, nodeID)
+	}
+
+	if verifyMessageCmd.Parsed() {
+		if *verifyMessageAddress == "" || *verifyMessageSignature == "" {
+			verifyMessageCmd.Usage()
+			os.Exit(1)
+		}
+		cli.verifyMessage(*verifyMessageAddress, *verifyMessageSignature, *verifyMessageMessage)
+	}
+
+	if encryptWalletCmd.Parsed() {
+		cli.encryptWallet(nodeID)
+	}
+
+	if changePassphraseCmd.Parsed() {
+		cli.changePassphrase(nodeID)
+	}
+
+	if walletPassphraseCmd.Parsed() {
+		if *walletPassphraseTimeout <= 0 {
+			walletPassphraseCmd.Usage()
+			os.Exit(1)
+		}
+		cli.walletPassphrase(*walletPassphraseTimeout, nodeID)
+	}
+
+	if walletLockCmd.Parsed() {
+		cli.walletLock(nodeID)
+	}
+
+	if listBannedCmd.Parsed() {
+		cli.listBanned(nodeID)
+	}
+
+	if setBanCmd.Parsed() {
+		if *setBanIP == "" || *setBanDuration < 0 {
+			setBanCmd.Usage()
+			os.Exit(1)
+		}
+		cli.setBan(*setBanIP, *setBanRemove, *setBanDuration, nodeID)
+	}
+
+	if getWalletBalanceCmd.Parsed() {
+		cli.getWalletBalance(nodeID)
+	}
+
+	if listUnspentCmd.Parsed() {
+		if *listUnspentMinConf < 0 || *listUnspentMaxConf < *listUnspentMinConf {
+			listUnspentCmd.Usage()
+			os.Exit(1)
+		}
+		cli.listUnspent(*listUnspentMinConf, *listUnspentMaxConf, nodeID)
+	}
+
+	if listTransactionsCmd.Parsed() {
+		cli.listTransactions(nodeID)
+	}
+
+	if dumpPrivKeyCmd.Parsed() {
+		if *dumpPrivKeyAddress == "" {
+			dumpPrivKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.dumpPrivKey(*dumpPrivKeyAddress, nodeID)
+	}
+
+	if importPrivKeyCmd.Parsed() {
+		if *importPrivKeyPrivKey == "" {
+			importPrivKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importPrivKey(*importPrivKeyPrivKey, nodeID)
+	}
+
+	if dumpWalletCmd.Parsed() {
+		if *dumpWalletFile == "" {
+			dumpWalletCmd.Usage()
+			os.Exit(1)
+		}
+		cli.dumpWallet(*dumpWalletFile, nodeID)
+	}
+
+	if importWalletCmd.Parsed() {
+		if *importWalletFile == "" {
+			importWalletCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importWallet(*importWalletFile, nodeID)
+	}
+
+	if importAddressCmd.Parsed() {
+		if *importAddressAddress == "" {
+			importAddressCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importAddress(*importAddressAddress, *importAddressRescan, nodeID)
+	}
+
+	if importPubKeyCmd.Parsed() {
+		if *importPubKeyPubKey == "" {
+			importPubKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importPubKey(*importPubKeyPubKey, *importPubKeyRescan, nodeID)
+	}
+
+	if restoreWalletCmd.Parsed() {
+		if *restoreWalletMnemonic == "" {
+			restoreWalletCmd.Usage()
+			os.Exit(1)
+		}
+		cli.restoreWallet(*restoreWalletMnemonic, nodeID)
+	}
+
+	if createRawTxCmd.Parsed() {
+		var recipients []Recipient
+		selector, ok := coinSelectors[*createRawTxCoinSelect]
+		if *createRawTxFrom == "" || !ok {
+			createRawTxCmd.Usage()
+			os.Exit(1)
+		}
+
+		if *createRawTxFile != "" {
+			var err error
+			recipients, err = LoadRecipients(*createRawTxFile)
+			if err != nil {
+				log.Panic(err)
+			}
+		} else {
+			recipient, err := newRecipient(*createRawTxTo, *createRawTxAmount)
+			if err != nil {
+				createRawTxCmd.Usage()
+				os.Exit(1)
+			}
+			recipients = append(recipients, recipient)
+		}
+
+		cli.createRawTx(*createRawTxFrom, recipients, selector, *createRawTxOut, nodeID)
+	}
+
+	if signRawTxCmd.Parsed() {
+		if *signRawTxIn == "" {
+			signRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		cli.signRawTx(*signRawTxIn, *signRawTxOut, nodeID)
+	}
+
+	if sendRawTxCmd.Parsed() {
+		if *sendRawTxIn == "" {
+			sendRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		cli.sendRawTx(*sendRawTxIn, *sendRawTxMiner, nodeID)
 	}
 
 	if listAddressesCmd.Parsed() {
-		cli.listAddresses(nodeID)
+		cli.listAddresses(*listAddressesBech32, nodeID)
 	}
 
 	if printChainCmd.Parsed() {
@@ -134,22 +571,45 @@ func (cli *CLI) Run() {
 	}
 
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		amount, err := ParseAmount(*sendAmount)
+		selector, ok := coinSelectors[*sendCoinSelect]
+		if *sendFrom == "" || *sendTo == "" || err != nil || amount <= 0 || !ok {
 			sendCmd.Usage()
 			os.Exit(1)
 		}
 
-		cli.send(*sendFrom, *sendTo, *sendAmount, nodeID, *sendMine)
+		if *sendRPC {
+			cli.sendRPC(*sendFrom, *sendTo, amount, *sendCoinSelect, nodeID)
+		} else {
+			cli.send(*sendFrom, *sendTo, amount, selector, nodeID, *sendMine)
+		}
 	}
 
-	if startNodeCmd.Parsed() {
-		nodeID := os.Getenv("NODE_ID")
-		if nodeID == "" {
-			startNodeCmd.Usage()
+	if generateCmd.Parsed() {
+		if *generateAddress == "" || *generateBlockCount <= 0 {
+			generateCmd.Usage()
 			os.Exit(1)
 		}
+		cli.generate(*generateBlockCount, *generateAddress, nodeID)
+	}
 
-		cli.startNode(nodeID, *startNodeMiner)
+	if sendManyCmd.Parsed() {
+		selector, ok := coinSelectors[*sendManyCoinSelect]
+		if *sendManyFrom == "" || *sendManyFile == "" || !ok {
+			sendManyCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.sendMany(*sendManyFrom, *sendManyFile, selector, nodeID, *sendManyMine)
+	}
+
+	if startNodeCmd.Parsed() {
+		minerAddress := *startNodeMiner
+		if minerAddress == "" {
+			minerAddress = cfg.Miner
+		}
+
+		cli.startNode(nodeID, minerAddress)
 	}
 }
 
@@ -157,8 +617,8 @@ func (cli *CLI) Run() {
 func (cli *CLI) createBlockchain(address, nodeID string) {
 	//验证地址是否正确
 	//wallet.go/func ValidateAddress(address string) bool
-	if !ValidateAddress(address) {
-		log.Panic("ERROR: Address is not valid")
+	if _, err := DecodeAddress(address); err != nil {
+		log.Panic("ERROR: Address is not valid: ", err)
 	}
 	//创建区块链
 	bc := CreateBlockchain(address, nodeID)
@@ -171,49 +631,314 @@ func (cli *CLI) createBlockchain(address, nodeID string) {
 }
 
 //创建钱包
-func (cli *CLI) createWallet(nodeID string) {
-	wallets, _ := NewWallets(nodeID)
-	address := wallets.CreateWallet()
+//一次生成多个地址时只写一次钱包文件
+func (cli *CLI) createWallet(keyType KeyType, count int, bech32 bool, nodeID string) {
+	wallets := cli.openOrCreateWallets(nodeID)
+
+	//HD 钱包的新地址不能超过恢复钱包时的查找范围
+	if keyType == KeyTypeP256 && wallets.Mnemonic != "" {
+		used := make(map[string]bool)
+		if dbExists(dbPath(nodeID)) {
+			bc := NewBlockchain(nodeID)
+			used = bc.FindUsedPubKeyHashes()
+			bc.db.Close()
+		}
+		err := wallets.CheckGapLimit(count, func(pubKeyHash []byte) bool {
+			return used[hex.EncodeToString(pubKeyHash)]
+		})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	addresses := wallets.CreateWallets(keyType, count)
+	wallets.SaveToFile(nodeID)
+
+	for _, address := range addresses {
+		if bech32 {
+			address = wallets.GetBech32Address(address)
+		}
+		fmt.Printf("Your new address: %s\n", address)
+	}
+	if keyType != KeyTypeP256 && wallets.Mnemonic != "" {
+		fmt.Printf("Warning: %s keys are not derived from the mnemonic, back them up with dumpwallet\n", keyType)
+	}
+}
+
+//搜索以 prefix 开头的地址并加入钱包
+func (cli *CLI) vanityAddress(prefix string, keyType KeyType, workers int, nodeID string) {
+	//先打开钱包，避免搜索完成后才发现密码错误
+	wallets := cli.openOrCreateWallets(nodeID)
+
+	difficulty := vanityDifficulty(prefix)
+	fmt.Printf("Difficulty: about %.0f keys, searching with %d workers\n", difficulty, workers)
+
+	start := time.Now()
+	wallet, err := FindVanityAddress(prefix, keyType, workers, func(attempts uint64) {
+		elapsed := time.Since(start).Seconds()
+		rate := float64(attempts) / elapsed
+		//找到的概率是 1 - (1 - 1/difficulty)^attempts
+		probability := 1 - math.Exp(-float64(attempts)/difficulty)
+		fmt.Printf("%d keys, %.0f keys/s, %.1f%% chance so far, about %.0fs for 50%%\n",
+			attempts, rate, probability*100, difficulty*math.Ln2/rate)
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	address := wallets.AddWallet(wallet)
 	wallets.SaveToFile(nodeID)
 
-	fmt.Printf("Your new address: %s\n", address)
+	fmt.Printf("Your new address: %s (found in %s)\n", address, time.Since(start).Round(time.Second))
+	if wallets.Mnemonic != "" {
+		fmt.Println("Warning: vanity keys are not derived from the mnemonic, back them up with dumpwallet")
+	}
 }
 
 //获得账本的余额状态
 func (cli *CLI) getBalance(address, nodeID string) {
-	//验证地址正确性
-	if !ValidateAddress(address) {
-		log.Panic("ERROR: Address is not valid")
+	//验证地址正确性，并解码获得公钥哈希
+	pubKeyHash, err := DecodeAddress(address)
+	if err != nil {
+		log.Panic("ERROR: Address is not valid: ", err)
 	}
 	bc := NewBlockchain(nodeID)
 	UTXOSet := UTXOSet{bc}
 	defer bc.db.Close()
 
-	balance := 0
-	//对经过base58编码后的地址进行解码获得公钥
-	pubKeyHash := Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	//找到UTXO集中特定公钥的余额状态
-	UTXOs := UTXOSet.FindUTXO(pubKeyHash)
+	//找到UTXO集中特定公钥的余额状态，尚未成熟的 coinbase 奖励单独统计
+	spendable, immature := UTXOSet.FindBalance(pubKeyHash)
 
-	for _, out := range UTXOs {
-		balance += out.Value
-	}
+	fmt.Printf("Balance of '%s': %s\n", address, spendable)
+	fmt.Printf("Immature: %s\n", immature)
 
-	fmt.Printf("Balance of '%s': %d\n", address, balance)
+	//只观察的地址保存在钱包文件中，查询余额不需要密码，钱包加密或不存在时不显示这一项
+	if wallets, err := NewWallets(nodeID); err == nil && wallets.IsWatchOnly(address) {
+		fmt.Println("Watch-only: true")
+	}
 }
 
 //获得区块链中所有交易的地址
-func (cli *CLI) listAddresses(nodeID string) {
+func (cli *CLI) listAddresses(bech32 bool, nodeID string) {
+	wallets := cli.openWallets(nodeID)
+	addresses := wallets.GetAddresses()
+
+	for _, address := range addresses {
+		watchOnly := wallets.IsWatchOnly(address)
+		if bech32 {
+			address = wallets.GetBech32Address(address)
+		}
+		if watchOnly {
+			fmt.Printf("%s (watch-only)\n", address)
+		} else {
+			fmt.Println(address)
+		}
+	}
+}
+
+//整个钱包的余额
+func (cli *CLI) getWalletBalance(nodeID string) {
+	wallets := cli.openWallets(nodeID)
+	balance := SumWalletBalance(cli.findWalletUnspent(wallets, nodeID))
+
+	fmt.Printf("Confirmed: %s\n", balance.Confirmed)
+	fmt.Printf("Unconfirmed: %s\n", balance.Unconfirmed)
+	fmt.Printf("Immature: %s\n", balance.Immature)
+}
+
+//列出钱包中确认数在 minConf 和 maxConf 之间的未花费输出
+func (cli *CLI) listUnspent(minConf, maxConf int, nodeID string) {
+	wallets := cli.openWallets(nodeID)
+
+	for _, utxo := range cli.findWalletUnspent(wallets, nodeID) {
+		if utxo.Confirmations < minConf || utxo.Confirmations > maxConf {
+			continue
+		}
+
+		fmt.Printf("%x:%d %s %s, confirmations: %d", utxo.Txid, utxo.Vout, utxo.Address, utxo.Value, utxo.Confirmations)
+		if !utxo.Mature {
+			fmt.Print(" (immature)")
+		}
+		if wallets.IsWatchOnly(utxo.Address) {
+			fmt.Print(" (watch-only)")
+		}
+		fmt.Println()
+	}
+}
+
+//列出钱包的交易记录
+func (cli *CLI) listTransactions(nodeID string) {
+	wallets := cli.openWallets(nodeID)
+
+	var history []WalletTransaction
+	if !queryWallet("ListTransactions", wallets, nodeID, &history) {
+		fmt.Println("Node is not running, unconfirmed transactions are not included")
+		bc := NewBlockchain(nodeID)
+		history = ListWalletTransactions(wallets.PubKeyHashes(), bc, nil)
+		bc.db.Close()
+	}
+
+	for _, wtx := range history {
+		fmt.Printf("============ Transaction %x ============\n", wtx.TxID)
+		if wtx.Coinbase {
+			fmt.Println("Coinbase: true")
+		}
+		fmt.Printf("Received: %s\n", wtx.Received)
+		fmt.Printf("Sent: %s\n", wtx.Sent)
+		fmt.Printf("Fee: %s\n", wtx.Fee)
+		fmt.Printf("Net: %s\n", wtx.Received-wtx.Sent)
+		fmt.Printf("Confirmations: %d\n", wtx.Confirmations)
+		fmt.Println()
+	}
+}
+
+//查询钱包的未花费输出，节点正在运行时由节点查询，这样可以包括内存池中的交易
+func (cli *CLI) findWalletUnspent(wallets *Wallets, nodeID string) []WalletUnspent {
+	var unspent []WalletUnspent
+	if queryWallet("ListUnspent", wallets, nodeID, &unspent) {
+		return unspent
+	}
+
+	fmt.Println("Node is not running, unconfirmed transactions are not included")
+	bc := NewBlockchain(nodeID)
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	return FindWalletUnspent(wallets.PubKeyHashes(), &UTXOSet, nil)
+}
+
+//导出一个地址的私钥
+func (cli *CLI) dumpPrivKey(address, nodeID string) {
+	wallets := cli.openWallets(nodeID)
+	wallet := wallets.GetWallet(address)
+
+	fmt.Println(EncodePrivateKey(&wallet))
+}
+
+//用地址的私钥签名消息
+func (cli *CLI) signMessage(address, message, nodeID string) {
+	if _, err := DecodeAddress(address); err != nil {
+		log.Panic("ERROR: Address is not valid: ", err)
+	}
+
+	wallets := cli.openWallets(nodeID)
+	wallet := wallets.GetWallet(address)
+
+	fmt.Println(wallet.SignMessage(message))
+}
+
+//验证消息的签名，不需要钱包和区块链
+func (cli *CLI) verifyMessage(address, signature, message string) {
+	ok, err := VerifyMessage(address, signature, message)
+	if err != nil {
+		fmt.Printf("Invalid signature: %s\n", err)
+		os.Exit(1)
+	}
+	if !ok {
+		fmt.Println("Signature does not match the address and message")
+		os.Exit(1)
+	}
+
+	fmt.Println("Signature is valid")
+}
+
+//导入 dumpprivkey 导出的私钥
+func (cli *CLI) importPrivKey(encoded, nodeID string) {
+	wallet, err := DecodePrivateKey(encoded)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallets := cli.openOrCreateWallets(nodeID)
+	address, err := wallets.ImportPrivateKey(wallet)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveToFile(nodeID)
+
+	fmt.Printf("Imported %s\n", address)
+}
+
+//将整个钱包备份为文本文件
+func (cli *CLI) dumpWallet(file, nodeID string) {
+	wallets := cli.openWallets(nodeID)
+	err := wallets.DumpToFile(file)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Wallet dumped to %s, the file contains unencrypted private keys\n", file)
+}
+
+//导入 dumpwallet 备份的文本文件
+//钱包文件不存在时新建一个空的钱包，这样备份中的助记词会被完整地迁移过来
+func (cli *CLI) importWallet(file, nodeID string) {
 	wallets, err := NewWallets(nodeID)
+	if os.IsNotExist(err) {
+		wallets.SetPassphrase(readNewPassphrase())
+	} else {
+		wallets = cli.openWallets(nodeID)
+	}
+	imported, err := wallets.ImportFromFile(file)
 	if err != nil {
 		log.Panic(err)
 	}
-	addresses := wallets.GetAddresses()
+	wallets.SaveToFile(nodeID)
 
-	for _, address := range addresses {
-		fmt.Println(address)
+	fmt.Printf("Imported %d addresses\n", imported)
+}
+
+//导入只观察的地址
+func (cli *CLI) importAddress(address string, rescan bool, nodeID string) {
+	wallets := cli.openOrCreateWallets(nodeID)
+	err := wallets.ImportAddress(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveToFile(nodeID)
+
+	fmt.Printf("Watching %s\n", address)
+	if rescan {
+		pubKeyHash, _ := wallets.GetPubKeyHash(address)
+		cli.rescan(address, pubKeyHash, nodeID)
+	}
+}
+
+//导入只观察的公钥
+func (cli *CLI) importPubKey(pubKeyHex string, rescan bool, nodeID string) {
+	pubKey, err := hex.DecodeString(pubKeyHex)
+	if err != nil {
+		log.Panic("ERROR: Public key must be hex encoded")
+	}
+
+	wallets := cli.openOrCreateWallets(nodeID)
+	address, err := wallets.ImportPubKey(pubKey)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveToFile(nodeID)
+
+	fmt.Printf("Watching %s\n", address)
+	if rescan {
+		cli.rescan(address, HashPubKey(pubKey), nodeID)
+	}
+}
+
+//扫描区块链，检查导入的地址是否出现过，并输出它的余额
+func (cli *CLI) rescan(address string, pubKeyHash []byte, nodeID string) {
+	bc := NewBlockchain(nodeID)
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	if !bc.FindUsedPubKeyHashes()[hex.EncodeToString(pubKeyHash)] {
+		fmt.Printf("%s has not been used on the blockchain\n", address)
+		return
 	}
+
+	spendable, immature := UTXOSet.FindBalance(pubKeyHash)
+	fmt.Printf("Balance of '%s': %s\n", address, spendable)
+	fmt.Printf("Immature: %s\n", immature)
 }
 
 //输出区块链
@@ -258,50 +983,406 @@ func (cli *CLI) reindexUTXO(nodeID string) {
 //当一个挖矿节点开始挖出一个新块时，它会将交易从队列中取出，并在前面附加一笔 coinbase 交易。
 //coinbase 交易只有一个输出，里面包含了矿工的公钥哈希。
 //实现奖励，非常简单，更新 send 即可
-func (cli *CLI) send(from, to string, amount int, nodeID string, mineNow bool) {
+func (cli *CLI) send(from, to string, amount Amount, selector CoinSelector, nodeID string, mineNow bool) {
 	//验证地址正确性
-	if !ValidateAddress(from) {
-		log.Panic("ERROR: Sender address is not valid")
+	if _, err := DecodeAddress(from); err != nil {
+		log.Panic("ERROR: Sender address is not valid: ", err)
 	}
-	if !ValidateAddress(to) {
-		log.Panic("ERROR: Recipient address is not valid")
+	if _, err := DecodeAddress(to); err != nil {
+		log.Panic("ERROR: Recipient address is not valid: ", err)
 	}
 
 	bc := NewBlockchain(nodeID)
 	UTXOSet := UTXOSet{bc}
 	defer bc.db.Close()
 
-	wallets, err := NewWallets(nodeID)
+	wallets := cli.openWallets(nodeID)
+	wallet := wallets.GetWallet(from)
+
+	tx, fee, err := NewUTXOTransaction(&wallet, to, amount, selector, &UTXOSet)
+	if err != nil {
+		log.Panic("ERROR: ", err)
+	}
+	fmt.Printf("Fee: %s\n", fee)
+
+	cli.submitTransaction(tx, from, &UTXOSet, mineNow)
+
+	fmt.Println("Success")
+}
+
+//批量付款：从文件中读取所有收款方，只生成一笔带有一个找零输出的交易
+func (cli *CLI) sendMany(from, file string, selector CoinSelector, nodeID string, mineNow bool) {
+	if _, err := DecodeAddress(from); err != nil {
+		log.Panic("ERROR: Sender address is not valid: ", err)
+	}
+
+	recipients, err := LoadRecipients(file)
 	if err != nil {
 		log.Panic(err)
 	}
+
+	bc := NewBlockchain(nodeID)
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	wallets := cli.openWallets(nodeID)
 	wallet := wallets.GetWallet(from)
 
-	tx := NewUTXOTransaction(&wallet, to, amount, &UTXOSet)
+	tx, fee, err := NewMultiRecipientTransaction(&wallet, recipients, selector, &UTXOSet)
+	if err != nil {
+		log.Panic("ERROR: ", err)
+	}
+	fmt.Printf("Paying %d recipients, fee: %s\n", len(recipients), fee)
+
+	cli.submitTransaction(tx, from, &UTXOSet, mineNow)
+
+	fmt.Println("Success")
+}
+
+//在联网节点上创建未签名的交易，只需要付款地址，不需要它的私钥
+func (cli *CLI) createRawTx(from string, recipients []Recipient, selector CoinSelector, out, nodeID string) {
+	if _, err := DecodeAddress(from); err != nil {
+		log.Panic("ERROR: Sender address is not valid: ", err)
+	}
+
+	bc := NewBlockchain(nodeID)
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	tx, selection, err := NewUnsignedTransaction(from, recipients, selector, &UTXOSet)
+	if err != nil {
+		log.Panic("ERROR: ", err)
+	}
+	psbt := NewPartiallySignedTransaction(tx, &UTXOSet)
+	fmt.Printf("Inputs: %d, fee: %s\n", len(tx.Vin), selection.Fee)
+
+	psbt.SaveToFile(out)
+}
+
+//在离线钱包上签名，只读取钱包文件，不打开区块链数据库
+func (cli *CLI) signRawTx(in, out, nodeID string) {
+	psbt, err := LoadPSBT(in)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallets := cli.openWallets(nodeID)
+
+	//在签名之前展示交易内容，方便在离线机器上核对
+	for i, out := range psbt.Tx.Vout {
+		fmt.Printf("Output %d: %s to %x\n", i, out.Value, out.PubKeyHash)
+	}
+	fmt.Printf("Fee: %s\n", psbt.Fee())
+
+	signed := psbt.Sign(wallets)
+	fmt.Printf("Signed %d of %d inputs, complete: %t\n", signed, len(psbt.Tx.Vin), psbt.IsComplete())
+
+	psbt.SaveToFile(out)
+}
+
+//广播已经完成签名的交易，设置了 miner 时在本节点直接挖矿
+func (cli *CLI) sendRawTx(in, miner, nodeID string) {
+	psbt, err := LoadPSBT(in)
+	if err != nil {
+		log.Panic(err)
+	}
+	if !psbt.IsComplete() {
+		log.Panic("ERROR: Transaction is not fully signed")
+	}
+	if miner != "" {
+		if _, err := DecodeAddress(miner); err != nil {
+			log.Panic("ERROR: Miner address is not valid: ", err)
+		}
+	}
+
+	bc := NewBlockchain(nodeID)
+	UTXOSet := UTXOSet{bc}
+	defer bc.db.Close()
+
+	cli.submitTransaction(&psbt.Tx, miner, &UTXOSet, miner != "")
+
+	fmt.Printf("Sent transaction %x\n", psbt.Tx.ID)
+}
 
-	//挖矿节点挖出新的块
+//挖矿节点直接把交易打包进新的块，奖励发给 from；否则依次尝试种子节点，发送给第一个能连接的节点
+func (cli *CLI) submitTransaction(tx *Transaction, from string, UTXOSet *UTXOSet, mineNow bool) {
 	if mineNow {
 		//新建一个Coinbase区块
 		cbTx := NewCoinbaseTX(from, "")
 		txs := []*Transaction{cbTx, tx}
 
-		newBlock := bc.MineBlock(txs)
+		newBlock := UTXOSet.Blockchain.MineBlock(txs)
 		UTXOSet.Update(newBlock)
 	} else {
-		sendTx(knownNodes[0], tx)
+		var err error
+		for _, node := range knownNodes {
+			err = relayTransaction(node, tx, UTXOSet.Blockchain)
+			if err == nil {
+				return
+			}
+		}
+		log.Panic("ERROR: No seed node is available: ", err)
 	}
+}
 
-	fmt.Println("Success")
+//立即挖出区块，节点正在运行时由节点挖矿，这样区块会包含节点内存池中的交易并广播出去
+//节点没有运行时直接写入本地区块链，此时没有内存池
+func (cli *CLI) generate(blocks int, address, nodeID string) {
+	if _, err := DecodeAddress(address); err != nil {
+		log.Panic("ERROR: Address is not valid: ", err)
+	}
+
+	var hashes [][]byte
+	if client := dialRunningNode(nodeID); client != nil {
+		defer client.Close()
+
+		err := client.Call("Node.Generate", GenerateArgs{blocks, address}, &hashes)
+		if err != nil {
+			log.Panic(err)
+		}
+	} else {
+		bc := NewBlockchain(nodeID)
+		defer bc.db.Close()
+
+		for _, block := range generateBlocks(bc, blocks, address) {
+			hashes = append(hashes, block.Hash)
+		}
+	}
+
+	for _, hash := range hashes {
+		fmt.Printf("%x\n", hash)
+	}
 }
 
 func (cli *CLI) startNode(nodeID, minerAddress string) {
-	fmt.Printf("Starting node %s\n", nodeID)
-	if len(miningAddress) > 0 {
-		if ValidateAddress(miningAddress) {
+	fmt.Printf("Starting node %s on the %s network\n", nodeID, activeNetParams.Name)
+	if len(minerAddress) > 0 {
+		if ValidateAddress(minerAddress) {
 			fmt.Println("Mining is on. Address to receive rewards: ", minerAddress)
 		} else {
 			log.Panic("Wrong miner address!")
 		}
 	}
-	StartServer(nodeID, miningAddress)
+	StartServer(nodeID, minerAddress)
+}
+
+//通过正在运行的节点发送交易，节点的钱包需要先用 walletpassphrase 解锁
+func (cli *CLI) sendRPC(from, to string, amount Amount, coinSelect, nodeID string) {
+	client := dialRPC(nodeID)
+	defer client.Close()
+
+	var reply SendReply
+	err := client.Call("Node.Send", SendArgs{from, to, amount, coinSelect}, &reply)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Fee: %s\n", reply.Fee)
+	fmt.Printf("Sent transaction %x\n", reply.TxID)
+}
+
+//由助记词恢复钱包文件，存在区块链数据库时扫描链上用过的地址
+func (cli *CLI) restoreWallet(mnemonic, nodeID string) {
+	walletFile := walletPath(nodeID)
+	if _, err := os.Stat(walletFile); !os.IsNotExist(err) {
+		log.Panicf("ERROR: Wallet file %s already exists", walletFile)
+	}
+
+	used := make(map[string]bool)
+	var bc *Blockchain
+	if dbExists(dbPath(nodeID)) {
+		bc = NewBlockchain(nodeID)
+		defer bc.db.Close()
+		used = bc.FindUsedPubKeyHashes()
+	} else {
+		fmt.Println("Warning: no blockchain found, only the first address is restored")
+	}
+
+	wallets, err := RestoreWallets(mnemonic, func(pubKeyHash []byte) bool {
+		return used[hex.EncodeToString(pubKeyHash)]
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SetPassphrase(readNewPassphrase())
+	wallets.SaveToFile(nodeID)
+
+	for _, address := range wallets.GetAddresses() {
+		if bc == nil {
+			fmt.Println(address)
+			continue
+		}
+
+		UTXOSet := UTXOSet{bc}
+		wallet := wallets.GetWallet(address)
+		spendable, immature := UTXOSet.FindBalance(HashPubKey(wallet.PublicKey))
+		fmt.Printf("%s: %s (immature %s)\n", address, spendable, immature)
+	}
+	fmt.Printf("Restored %d addresses\n", len(wallets.Wallets))
+}
+
+//将旧的明文钱包文件迁移为加密的钱包文件
+func (cli *CLI) encryptWallet(nodeID string) {
+	wallets, err := NewWallets(nodeID)
+	if err == errWalletEncrypted {
+		log.Panic("ERROR: Wallet file is already encrypted, use changepassphrase")
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallets.SetPassphrase(readNewPassphrase())
+	wallets.SaveToFile(nodeID)
+
+	fmt.Println("Wallet encrypted")
+}
+
+//使用新的密码重新加密钱包文件
+func (cli *CLI) changePassphrase(nodeID string) {
+	wallets := cli.openWallets(nodeID)
+	if !wallets.IsEncrypted() {
+		log.Panic("ERROR: Wallet file is not encrypted, use encryptwallet")
+	}
+
+	wallets.SetPassphrase(readNewPassphrase())
+	wallets.SaveToFile(nodeID)
+
+	fmt.Println("Passphrase changed")
+}
+
+//在一段时间内解锁正在运行的节点中的钱包
+func (cli *CLI) walletPassphrase(timeout int, nodeID string) {
+	//明文钱包不需要密码，节点只在解锁期间加载它
+	var passphrase []byte
+	_, err := NewWallets(nodeID)
+	if err == errWalletEncrypted {
+		passphrase = readPassphrase("Wallet passphrase: ", "WALLET_PASSPHRASE")
+	} else if err != nil {
+		log.Panic(err)
+	}
+
+	client := dialRPC(nodeID)
+	defer client.Close()
+
+	var reply bool
+	err = client.Call("Node.WalletPassphrase", WalletPassphraseArgs{passphrase, timeout}, &reply)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Wallet unlocked for %d seconds\n", timeout)
+}
+
+//立即锁定正在运行的节点中的钱包
+func (cli *CLI) walletLock(nodeID string) {
+	client := dialRPC(nodeID)
+	defer client.Close()
+
+	var reply bool
+	err := client.Call("Node.WalletLock", WalletLockArgs{}, &reply)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Println("Wallet locked")
+}
+
+//列出正在运行的节点禁止的 IP
+func (cli *CLI) listBanned(nodeID string) {
+	client := dialRPC(nodeID)
+	defer client.Close()
+
+	var bans []BanEntry
+	err := client.Call("Node.ListBanned", ListBannedArgs{}, &bans)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	for _, ban := range bans {
+		fmt.Printf("%s until %s: %s\n", ban.Address, ban.Until.Format(time.RFC3339), ban.Reason)
+	}
+}
+
+//在正在运行的节点上禁止或解除禁止一个 IP
+func (cli *CLI) setBan(ip string, remove bool, duration int, nodeID string) {
+	client := dialRPC(nodeID)
+	defer client.Close()
+
+	var reply bool
+	err := client.Call("Node.SetBan", SetBanArgs{ip, remove, duration}, &reply)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if remove {
+		fmt.Printf("%s is no longer banned\n", ip)
+	} else {
+		fmt.Printf("%s is banned\n", ip)
+	}
+}
+
+//打开钱包文件，文件不存在时新建，新的钱包文件总是加密保存
+//新的钱包文件是 HD 钱包，助记词只在这里输出一次，之后的地址都由它派生
+func (cli *CLI) openOrCreateWallets(nodeID string) *Wallets {
+	wallets, err := NewWallets(nodeID)
+	if !os.IsNotExist(err) {
+		return cli.openWallets(nodeID)
+	}
+
+	wallets, err = NewHDWallets(NewMnemonic())
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SetPassphrase(readNewPassphrase())
+
+	fmt.Printf("Your mnemonic: %s\n", wallets.Mnemonic)
+	fmt.Println("Write it down and keep it safe, it restores every address of this wallet")
+
+	return wallets
+}
+
+//打开钱包文件，钱包已加密时读取密码解密
+func (cli *CLI) openWallets(nodeID string) *Wallets {
+	wallets, err := NewWallets(nodeID)
+	if err == errWalletEncrypted {
+		passphrase := readPassphrase("Wallet passphrase: ", "WALLET_PASSPHRASE")
+		wallets, err = NewWalletsWithPassphrase(nodeID, passphrase)
+	} else if err == nil {
+		fmt.Println("Warning: wallet file is not encrypted, run encryptwallet to protect it")
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return wallets
+}
+
+//读取钱包密码，设置了环境变量 env 时直接使用它，否则在终端中输入（不回显）
+func readPassphrase(prompt, env string) []byte {
+	if passphrase := os.Getenv(env); passphrase != "" {
+		return []byte(passphrase)
+	}
+
+	fmt.Print(prompt)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return passphrase
+}
+
+//读取新的钱包密码，在终端中输入时需要输入两次确认
+func readNewPassphrase() []byte {
+	passphrase := readPassphrase("New wallet passphrase: ", "WALLET_NEW_PASSPHRASE")
+	confirm := readPassphrase("Repeat new wallet passphrase: ", "WALLET_NEW_PASSPHRASE")
+	if len(passphrase) == 0 {
+		log.Panic("ERROR: Passphrase must not be empty")
+	}
+	if string(passphrase) != string(confirm) {
+		log.Panic("ERROR: Passphrases do not match")
+	}
+
+	return passphrase
 }
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+)
+
+//交易大小的估算值（字节），用于计算手续费
+//交易使用 gob 编码，实际大小会有少量浮动
+const txBaseSize = 50
+const txInputSize = 180
+const txOutputSize = 40
+
+//每字节的手续费，以最小单位计
+const feePerByte Amount = 1
+
+//小于这个值的找零不值得单独生成输出，会直接留作手续费
+const dustThreshold Amount = 3 * feePerByte * (txInputSize + txOutputSize)
+
+//branch-and-bound 最多尝试的搜索次数
+const bnbMaxTries = 100000
+
+//一个可以被花费的输出，以及它在UTXO集中的位置
+type SpendableOutput struct {
+	Txid   []byte
+	Vout   int
+	Output TXOutput
+}
+
+//选币的结果：被选中的输入、输入总额、估算的手续费以及找零
+//Total = 目标金额 + Fee + Change，Change 为 0 时交易没有找零输出
+type CoinSelection struct {
+	Inputs []SpendableOutput
+	Total  Amount
+	Fee    Amount
+	Change Amount
+}
+
+//选币策略：从候选输出中选出足够支付 target 以及手续费的输入
+//numOutputs 是除找零之外的输出个数，用于估算交易大小
+type CoinSelector func(utxos []SpendableOutput, target Amount, numOutputs int) (CoinSelection, error)
+
+//可以通过 send -coinselect 选择的策略
+var coinSelectors = map[string]CoinSelector{
+	"bnb":      selectBranchAndBound,
+	"largest":  selectLargestFirst,
+	"smallest": selectSmallestFirst,
+	"random":   selectRandomImprove,
+}
+
+const defaultCoinSelector = "bnb"
+
+var errInsufficientFunds = errors.New("Not enough funds.")
+
+//估算一笔有 numInputs 个输入、numOutputs 个输出的交易的手续费
+func estimateFee(numInputs, numOutputs int) Amount {
+	size := txBaseSize + numInputs*txInputSize + numOutputs*txOutputSize
+
+	return Amount(size) * feePerByte
+}
+
+//根据选中的输入计算手续费和找零
+//如果找零会小于 dustThreshold，就不生成找零输出，剩余部分全部作为手续费
+func newCoinSelection(inputs []SpendableOutput, target Amount, numOutputs int) (CoinSelection, bool) {
+	total := Amount(0)
+	for _, utxo := range inputs {
+		total += utxo.Output.Value
+	}
+
+	fee := estimateFee(len(inputs), numOutputs)
+	if total < target+fee {
+		return CoinSelection{}, false
+	}
+
+	feeWithChange := estimateFee(len(inputs), numOutputs+1)
+	change := total - target - feeWithChange
+	if change >= dustThreshold {
+		return CoinSelection{inputs, total, feeWithChange, change}, true
+	}
+
+	return CoinSelection{inputs, total, total - target, 0}, true
+}
+
+//按顺序累加输出，直到足够支付目标金额和手续费
+func accumulateCoins(utxos []SpendableOutput, target Amount, numOutputs int) (CoinSelection, error) {
+	var inputs []SpendableOutput
+
+	for _, utxo := range utxos {
+		inputs = append(inputs, utxo)
+		selection, ok := newCoinSelection(inputs, target, numOutputs)
+		if ok {
+			return selection, nil
+		}
+	}
+
+	return CoinSelection{}, errInsufficientFunds
+}
+
+//largest-first：优先使用金额最大的输出，输入最少，手续费最低
+func selectLargestFirst(utxos []SpendableOutput, target Amount, numOutputs int) (CoinSelection, error) {
+	sorted := append([]SpendableOutput{}, utxos...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Output.Value > sorted[j].Output.Value
+	})
+
+	return accumulateCoins(sorted, target, numOutputs)
+}
+
+//smallest-first：优先使用金额最小的输出，可以合并钱包中零碎的输出
+func selectSmallestFirst(utxos []SpendableOutput, target Amount, numOutputs int) (CoinSelection, error) {
+	sorted := append([]SpendableOutput{}, utxos...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Output.Value < sorted[j].Output.Value
+	})
+
+	return accumulateCoins(sorted, target, numOutputs)
+}
+
+//random-improve：先随机选择输出直到足够支付，
+//再随机尝试加入其它输出，使总额更接近目标金额的两倍（但不超过三倍），让找零和支付金额相当，
+//这样找零输出以后也能被用于类似大小的支付，避免钱包碎片化
+func selectRandomImprove(utxos []SpendableOutput, target Amount, numOutputs int) (CoinSelection, error) {
+	shuffled := append([]SpendableOutput{}, utxos...)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	selection, err := accumulateCoins(shuffled, target, numOutputs)
+	if err != nil {
+		return selection, err
+	}
+
+	inputs := selection.Inputs
+	total := selection.Total
+	ideal := 2 * target
+	for _, utxo := range shuffled[len(inputs):] {
+		newTotal := total + utxo.Output.Value
+		if newTotal > 3*target || abs(ideal-newTotal) >= abs(ideal-total) {
+			continue
+		}
+
+		inputs = append(inputs, utxo)
+		total = newTotal
+	}
+
+	//加入更多输入会增加手续费，如果因此不够支付就保留随机选择的结果
+	improved, ok := newCoinSelection(inputs, target, numOutputs)
+	if !ok {
+		return selection, nil
+	}
+
+	return improved, nil
+}
+
+//branch-and-bound：搜索一组输入，使其扣除各自手续费后的总额恰好落在
+//[目标金额 + 交易基础手续费, 再加上一个找零输出的成本] 之间，这样就不需要找零输出
+//找不到这样的组合时退回到 largest-first
+func selectBranchAndBound(utxos []SpendableOutput, target Amount, numOutputs int) (CoinSelection, error) {
+	//每个输入的有效金额是它的金额减去花费它所需的手续费
+	inputFee := Amount(txInputSize) * feePerByte
+	var pool []SpendableOutput
+	var values []Amount
+	remaining := Amount(0)
+
+	sorted := append([]SpendableOutput{}, utxos...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Output.Value > sorted[j].Output.Value
+	})
+	for _, utxo := range sorted {
+		value := utxo.Output.Value - inputFee
+		if value > 0 {
+			pool = append(pool, utxo)
+			values = append(values, value)
+			remaining += value
+		}
+	}
+
+	selectionTarget := target + estimateFee(0, numOutputs)
+	costOfChange := Amount(txOutputSize+txInputSize) * feePerByte
+	upperBound := selectionTarget + costOfChange
+
+	selected := make([]bool, len(pool))
+	var best []bool
+	bestExcess := Amount(-1)
+	tries := 0
+
+	var search func(depth int, sum, remaining Amount)
+	search = func(depth int, sum, remaining Amount) {
+		tries++
+		if tries > bnbMaxTries || sum > upperBound || sum+remaining < selectionTarget {
+			return
+		}
+
+		if sum >= selectionTarget {
+			excess := sum - selectionTarget
+			if bestExcess < 0 || excess < bestExcess {
+				best = append([]bool{}, selected...)
+				bestExcess = excess
+			}
+			return
+		}
+
+		if depth == len(pool) {
+			return
+		}
+
+		//先尝试包含当前输出，再尝试不包含
+		remaining -= values[depth]
+		selected[depth] = true
+		search(depth+1, sum+values[depth], remaining)
+		selected[depth] = false
+		search(depth+1, sum, remaining)
+	}
+	search(0, 0, remaining)
+
+	if best == nil {
+		return selectLargestFirst(utxos, target, numOutputs)
+	}
+
+	var inputs []SpendableOutput
+	total := Amount(0)
+	for i, ok := range best {
+		if ok {
+			inputs = append(inputs, pool[i])
+			total += pool[i].Output.Value
+		}
+	}
+
+	//多出的部分不足以支付一个找零输出，全部留作手续费
+	return CoinSelection{inputs, total, total - target, 0}, nil
+}
+
+func abs(a Amount) Amount {
+	if a < 0 {
+		return -a
+	}
+
+	return a
+}
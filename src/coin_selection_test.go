@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func testUTXOs(values ...Amount) []SpendableOutput {
+	var utxos []SpendableOutput
+	for i, value := range values {
+		utxos = append(utxos, SpendableOutput{[]byte{byte(i)}, 0, TXOutput{value, nil}})
+	}
+
+	return utxos
+}
+
+func TestBranchAndBoundExactMatch(t *testing.T) {
+	inputFee := Amount(txInputSize) * feePerByte
+	//两个较小的输出扣除各自的手续费后正好等于目标金额加上交易的基础手续费
+	utxos := testUTXOs(10*Coin, 3*Coin+inputFee, 2*Coin+inputFee)
+	target := 5*Coin - estimateFee(0, 1)
+
+	selection, err := selectBranchAndBound(utxos, target, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selection.Inputs) != 2 || selection.Change != 0 {
+		t.Fatalf("selected %d inputs with change %s", len(selection.Inputs), selection.Change)
+	}
+	if selection.Fee != estimateFee(2, 1) || selection.Total != target+selection.Fee {
+		t.Errorf("fee %s, total %s", selection.Fee, selection.Total)
+	}
+}
+
+func TestBranchAndBoundFallsBackToLargestFirst(t *testing.T) {
+	utxos := testUTXOs(7*Coin, 10*Coin)
+	target := Coin
+
+	selection, err := selectBranchAndBound(utxos, target, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	largest, _ := selectLargestFirst(utxos, target, 1)
+	if len(selection.Inputs) != 1 || selection.Inputs[0].Output.Value != 10*Coin || selection.Change != largest.Change {
+		t.Errorf("selected %+v, largest-first selects %+v", selection, largest)
+	}
+	if selection.Total != target+selection.Fee+selection.Change {
+		t.Errorf("total %s does not add up", selection.Total)
+	}
+
+	if _, err := selectBranchAndBound(utxos, 20*Coin, 1); err != errInsufficientFunds {
+		t.Errorf("expected errInsufficientFunds, got %v", err)
+	}
+}
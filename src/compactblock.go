@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//紧凑区块（BIP152）：新区块成为链尾时，不再发送 inv 等对方用 getdata 请求整个块，
+//而是直接发送块头、每笔交易 6 字节的短 ID 和预先填充的 coinbase 交易
+//对方的内存池中通常已经有块中的大部分交易，用短 ID 找到它们重建区块，只用 getblocktxn 请求缺少的交易
+//重建的块的哈希与块头不一致时（短 ID 冲突），改为请求完整的块
+//版本低于 compactBlocksVersion 的节点仍然收到 inv
+const compactBlocksVersion = 2
+
+//短 ID 的字节数
+const shortIDLength = 6
+
+//等待 blocktxn 的时间，超时后可以重新请求
+const blockTxnTimeout = 30 * time.Second
+
+//一个紧凑区块最多的短 ID 数，完整的块要放进 maxMessagePayload 字节的消息，一笔交易序列化后远多于 300 字节
+const maxCmpctShortIDs = maxMessagePayload / 300
+
+//区块中除了交易以外的字段
+type BlockHeader struct {
+	Timestamp     int64
+	PrevBlockHash []byte
+	Hash          []byte
+	Nonce         int
+	Height        int
+}
+
+//Index 是交易在区块中的位置
+type prefilledTx struct {
+	Index       int
+	Transaction []byte
+}
+
+//Nonce 与块的哈希一起决定短 ID 的计算方式，使得不同的块中同一笔交易的短 ID 不同
+//ShortIDs 按顺序对应区块中没有预先填充的交易
+type cmpctblock struct {
+	AddrFrom  string
+	Header    BlockHeader
+	Nonce     uint64
+	ShortIDs  []uint64
+	Prefilled []prefilledTx
+}
+
+//Indexes 是缺少的交易在区块中的位置
+type getblocktxn struct {
+	AddrFrom  string
+	BlockHash []byte
+	Indexes   []int
+}
+
+//按 getblocktxn 中的顺序返回交易
+type blocktxn struct {
+	AddrFrom     string
+	BlockHash    []byte
+	Transactions [][]byte
+}
+
+//正在等待 blocktxn 的区块，缺少的交易位置为 nil
+type partialBlock struct {
+	header    BlockHeader
+	txs       []*Transaction
+	missing   []int
+	requested time.Time
+}
+
+//等待 blocktxn 的区块，以区块哈希为键
+var partialBlocks = make(map[string]*partialBlock)
+
+func (b *Block) Header() BlockHeader {
+	return BlockHeader{b.Timestamp, b.PrevBlockHash, b.Hash, b.Nonce, b.Height}
+}
+
+//计算短 ID 的密钥
+func shortIDKey(blockHash []byte, nonce uint64) []byte {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, nonce)
+	key := sha256.Sum256(append(append([]byte{}, blockHash...), data...))
+
+	return key[:]
+}
+
+//交易的短 ID 是 SHA-256(密钥 + 交易 ID) 的前 6 个字节
+func shortTxID(key, txID []byte) uint64 {
+	hash := sha256.Sum256(append(append([]byte{}, key...), txID...))
+
+	var id [8]byte
+	copy(id[:], hash[:shortIDLength])
+
+	return binary.LittleEndian.Uint64(id[:])
+}
+
+//根据完整的区块构造紧凑区块，位置 0 的 coinbase 交易预先填充，对方的内存池中不会有它
+func newCompactBlock(b *Block) cmpctblock {
+	cmpct := cmpctblock{AddrFrom: nodeAddress, Header: b.Header(), Nonce: randomNonce()}
+	key := shortIDKey(b.Hash, cmpct.Nonce)
+
+	for i, tx := range b.Transactions {
+		if tx.IsCoinbase() {
+			cmpct.Prefilled = append(cmpct.Prefilled, prefilledTx{i, tx.Serialize()})
+			continue
+		}
+		cmpct.ShortIDs = append(cmpct.ShortIDs, shortTxID(key, tx.ID))
+	}
+
+	return cmpct
+}
+
+//用预先填充的交易和内存池中的交易重建区块，记录找不到的交易的位置
+//预先填充的必须恰好是位置 0 的 coinbase 交易，保证重建的块至少有一笔交易
+//内存池中两笔交易的短 ID 相同时，无法确定是哪一笔，也当作缺少的交易
+func newPartialBlock(cmpct *cmpctblock) (*partialBlock, error) {
+	if len(cmpct.ShortIDs) > maxCmpctShortIDs {
+		return nil, fmt.Errorf("%d short IDs exceed the limit of %d", len(cmpct.ShortIDs), maxCmpctShortIDs)
+	}
+	if len(cmpct.Prefilled) != 1 || cmpct.Prefilled[0].Index != 0 {
+		return nil, errors.New("only the coinbase transaction at index 0 may be prefilled")
+	}
+	coinbase, err := ParseTransaction(cmpct.Prefilled[0].Transaction)
+	if err != nil {
+		return nil, err
+	}
+	if !coinbase.IsCoinbase() {
+		return nil, errors.New("prefilled transaction is not a coinbase")
+	}
+
+	n := len(cmpct.ShortIDs) + 1
+	pb := &partialBlock{header: cmpct.Header, txs: make([]*Transaction, n), requested: time.Now()}
+	pb.txs[0] = &coinbase
+
+	key := shortIDKey(cmpct.Header.Hash, cmpct.Nonce)
+	candidates := make(map[uint64]*Transaction)
+	collisions := make(map[uint64]bool)
+	for id := range mempool {
+		tx := mempool[id]
+		shortID := shortTxID(key, tx.ID)
+		if _, ok := candidates[shortID]; ok {
+			collisions[shortID] = true
+		}
+		candidates[shortID] = &tx
+	}
+
+	for i, shortID := range cmpct.ShortIDs {
+		tx, ok := candidates[shortID]
+		if ok && !collisions[shortID] {
+			pb.txs[i+1] = tx
+		} else {
+			pb.missing = append(pb.missing, i+1)
+		}
+	}
+
+	return pb, nil
+}
+
+func (pb *partialBlock) block() *Block {
+	h := pb.header
+
+	return &Block{h.Timestamp, pb.txs, h.PrevBlockHash, h.Hash, h.Nonce, h.Height}
+}
+
+//发送紧凑区块
+func sendCmpctBlock(p *Peer, payload []byte, hash []byte) {
+	p.AddKnownInventory("block", hash)
+	p.Send("cmpctblock", payload)
+}
+
+func handleCmpctBlock(p *Peer, request []byte, bc *Blockchain) error {
+	var buff bytes.Buffer
+	var payload cmpctblock
+
+	buff.Write(request)
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return misbehaving(misbehaviorMalformed, "malformed cmpctblock message: %s", err)
+	}
+
+	hash := payload.Header.Hash
+	p.AddKnownInventory("block", hash)
+
+	if _, err := bc.GetBlock(hash); err == nil {
+		return nil
+	}
+
+	//已经向其他节点请求过缺少的交易，等待对方回复
+	for id, pb := range partialBlocks {
+		if time.Since(pb.requested) >= blockTxnTimeout {
+			delete(partialBlocks, id)
+		}
+	}
+	if _, ok := partialBlocks[hex.EncodeToString(hash)]; ok {
+		return nil
+	}
+
+	//不接在链尾的块无法用内存池中的交易重建，请求完整的块
+	if !bytes.Equal(payload.Header.PrevBlockHash, bc.tip) {
+		if !blockIsInTransit(hash) {
+			sendGetData(p, "block", hash)
+		}
+		return nil
+	}
+
+	//接在链尾的块头的哈希和高度在重建之前就可以检查
+	if len(hash) != sha256.Size || payload.Header.Height != bc.GetBestHeight()+1 {
+		return misbehaving(misbehaviorMalformed, "malformed cmpctblock header %x at height %d", hash, payload.Header.Height)
+	}
+
+	pb, err := newPartialBlock(&payload)
+	if err != nil {
+		return misbehaving(misbehaviorMalformed, "malformed cmpctblock message: %s", err)
+	}
+
+	if len(pb.missing) > 0 {
+		logDebug("Requesting %d of %d transactions of block %x", len(pb.missing), len(pb.txs), hash)
+		partialBlocks[hex.EncodeToString(hash)] = pb
+		p.Send("getblocktxn", gobEncode(getblocktxn{nodeAddress, hash, pb.missing}))
+		return nil
+	}
+
+	return reconstructBlock(p, pb, bc)
+}
+
+//返回对方重建区块时缺少的交易
+func handleGetBlockTxn(p *Peer, request []byte, bc *Blockchain) error {
+	var buff bytes.Buffer
+	var payload getblocktxn
+
+	buff.Write(request)
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return misbehaving(misbehaviorMalformed, "malformed getblocktxn message: %s", err)
+	}
+
+	block, err := bc.GetBlock(payload.BlockHash)
+	if err != nil {
+		return nil
+	}
+
+	var txs [][]byte
+	for _, i := range payload.Indexes {
+		if i < 0 || i >= len(block.Transactions) {
+			return misbehaving(misbehaviorMalformed, "getblocktxn index %d is out of range", i)
+		}
+		txs = append(txs, block.Transactions[i].Serialize())
+	}
+
+	p.Send("blocktxn", gobEncode(blocktxn{nodeAddress, payload.BlockHash, txs}))
+
+	return nil
+}
+
+//用对方发来的交易补全区块
+func handleBlockTxn(p *Peer, request []byte, bc *Blockchain) error {
+	var buff bytes.Buffer
+	var payload blocktxn
+
+	buff.Write(request)
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return misbehaving(misbehaviorMalformed, "malformed blocktxn message: %s", err)
+	}
+
+	id := hex.EncodeToString(payload.BlockHash)
+	pb, ok := partialBlocks[id]
+	if !ok {
+		return nil
+	}
+	if len(payload.Transactions) != len(pb.missing) {
+		return misbehaving(misbehaviorMalformed, "blocktxn has %d transactions, %d requested", len(payload.Transactions), len(pb.missing))
+	}
+	delete(partialBlocks, id)
+
+	for i, txData := range payload.Transactions {
+		tx, err := ParseTransaction(txData)
+		if err != nil {
+			return misbehaving(misbehaviorMalformed, "malformed transaction: %s", err)
+		}
+		pb.txs[pb.missing[i]] = &tx
+	}
+
+	return reconstructBlock(p, pb, bc)
+}
+
+//重建的块的哈希与块头一致时按收到完整的块处理，否则请求完整的块
+func reconstructBlock(p *Peer, pb *partialBlock, bc *Blockchain) error {
+	block := pb.block()
+	if !bytes.Equal(NewProofOfWork(block).Hash(), block.Hash) {
+		logDebug("Failed to reconstruct block %x, requesting the full block", block.Hash)
+		sendGetData(p, "block", block.Hash)
+		return nil
+	}
+
+	logDebug("Reconstructed block %x with %d transactions", block.Hash, len(block.Transactions))
+
+	return processBlock(p, block, bc)
+}
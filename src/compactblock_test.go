@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+//不需要有效签名的交易，prev 使每笔交易的 ID 不同
+func testCmpctTx(prev byte) *Transaction {
+	tx := Transaction{nil, []TXInput{{[]byte{prev}, 0, nil, nil}}, []TXOutput{{Coin, []byte{prev}}}}
+	tx.ID = tx.Hash()
+
+	return &tx
+}
+
+//块头的哈希只用于计算短 ID，这里不需要工作量证明
+func testCmpctBlock(txs ...*Transaction) *Block {
+	coinbase := NewCoinbaseTX(string(NewWallet().GetAddress()), "")
+	hash := bytes.Repeat([]byte{1}, 32)
+
+	return &Block{0, append([]*Transaction{coinbase}, txs...), nil, hash, 0, 1}
+}
+
+func TestPartialBlockMissingTransactions(t *testing.T) {
+	resetMempool(t)
+	tx1, tx2, tx3 := testCmpctTx(1), testCmpctTx(2), testCmpctTx(3)
+	block := testCmpctBlock(tx1, tx2, tx3)
+	cmpct := newCompactBlock(block)
+	if len(cmpct.ShortIDs) != 3 || len(cmpct.Prefilled) != 1 {
+		t.Fatalf("expected 3 short IDs and the prefilled coinbase, got %d and %d", len(cmpct.ShortIDs), len(cmpct.Prefilled))
+	}
+
+	//内存池中只有 tx2，不在块中的交易不影响重建
+	addToMempool(tx2)
+	addToMempool(testCmpctTx(4))
+
+	pb, err := newPartialBlock(&cmpct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pb.missing) != 2 || pb.missing[0] != 1 || pb.missing[1] != 3 {
+		t.Fatalf("expected transactions 1 and 3 to be missing, got %v", pb.missing)
+	}
+	if pb.txs[1] != nil || pb.txs[3] != nil || !bytes.Equal(pb.txs[2].ID, tx2.ID) {
+		t.Fatal("transactions found in the mempool are not placed at their index")
+	}
+
+	//补全缺少的交易后得到原来的块
+	pb.txs[1], pb.txs[3] = tx1, tx3
+	rebuilt := pb.block()
+	if !bytes.Equal(rebuilt.HashTransactions(), block.HashTransactions()) || !bytes.Equal(rebuilt.Hash, block.Hash) {
+		t.Error("rebuilt block differs from the original block")
+	}
+
+	//blocktxn 中交易的数量必须与请求的一致
+	partialBlocks[hex.EncodeToString(block.Hash)] = pb
+	defer delete(partialBlocks, hex.EncodeToString(block.Hash))
+	pbs := len(partialBlocks)
+	err = handleBlockTxn(nil, gobEncode(blocktxn{"", block.Hash, [][]byte{tx1.Serialize()}}), nil)
+	if _, ok := err.(*Misbehavior); !ok {
+		t.Errorf("expected a short blocktxn to be misbehavior, got %v", err)
+	}
+	if len(partialBlocks) != pbs {
+		t.Error("partial block is dropped after a malformed blocktxn")
+	}
+}
+
+func TestPartialBlockShortIDCollision(t *testing.T) {
+	resetMempool(t)
+	tx1, tx2 := testCmpctTx(1), testCmpctTx(2)
+	cmpct := newCompactBlock(testCmpctBlock(tx1, tx2))
+
+	//48 位的短 ID 无法实际构造冲突，让内存池中两个条目的交易 ID 相同来模拟
+	addToMempool(tx1)
+	mempool["collision"] = *tx1
+	addToMempool(tx2)
+
+	pb, err := newPartialBlock(&cmpct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pb.missing) != 1 || pb.missing[0] != 1 || pb.txs[1] != nil {
+		t.Fatalf("expected the colliding transaction to be missing, got %v", pb.missing)
+	}
+	if !bytes.Equal(pb.txs[2].ID, tx2.ID) {
+		t.Error("transaction without a collision is not found")
+	}
+}
+
+func TestPartialBlockRejectsBadPrefilled(t *testing.T) {
+	resetMempool(t)
+	tx := testCmpctTx(1)
+	cmpct := newCompactBlock(testCmpctBlock(tx))
+
+	bad := cmpct
+	bad.Prefilled = []prefilledTx{{1, cmpct.Prefilled[0].Transaction}}
+	_, err := newPartialBlock(&bad)
+	expectError(t, err, "index 0")
+
+	bad.Prefilled = nil
+	_, err = newPartialBlock(&bad)
+	expectError(t, err, "index 0")
+
+	bad.Prefilled = []prefilledTx{{0, tx.Serialize()}}
+	_, err = newPartialBlock(&bad)
+	expectError(t, err, "not a coinbase")
+
+	bad.Prefilled = cmpct.Prefilled
+	bad.ShortIDs = make([]uint64, maxCmpctShortIDs+1)
+	_, err = newPartialBlock(&bad)
+	expectError(t, err, "exceed the limit")
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//数据目录中默认的配置文件，不存在时只使用默认值
+const defaultConfigFile = "blockchain.conf"
+
+//节点和命令行的配置，优先级从低到高依次为：
+//  默认值 < 配置文件 < NODE_ID 环境变量 < 命令行参数
+//配置文件默认是数据目录中的 blockchain.conf，可以用 -conf 指定其他文件
+type Config struct {
+	Network     string
+	DataDir     string
+	NodeID      string
+	Listen      string
+	External    string
+	Seeds       []string
+	Miner       string
+	RPCEnabled  bool
+	RPCListen   string
+	RPCPassword string
+	LogLevel    string
+	BanScore    int
+	BanTime     time.Duration
+}
+
+//违规分数达到 100 时禁止对方 24 小时
+const (
+	defaultBanScore = 100
+	defaultBanTime  = 24 * time.Hour
+)
+
+//当前使用的配置，由 Apply 设置
+var activeConfig = defaultConfig()
+
+func defaultConfig() *Config {
+	return &Config{
+		Network:    defaultNetwork,
+		DataDir:    ".",
+		RPCEnabled: true,
+		LogLevel:   defaultLogLevel,
+		BanScore:   defaultBanScore,
+		BanTime:    defaultBanTime,
+	}
+}
+
+//读取配置文件，依次应用环境变量和命令行参数，然后检查配置并补全未设置的地址
+//flags 中只有命令行上出现过的参数，confFile 为空时使用数据目录中的默认配置文件
+func LoadConfig(confFile string, flags map[string]string) (*Config, error) {
+	cfg := defaultConfig()
+
+	//数据目录决定默认配置文件的位置，所以先应用命令行的 -datadir
+	if dataDir, ok := flags["datadir"]; ok {
+		cfg.DataDir = dataDir
+	}
+	explicit := confFile != ""
+	if !explicit {
+		confFile = filepath.Join(cfg.DataDir, defaultConfigFile)
+	}
+	err := cfg.loadFile(confFile, explicit)
+	if err != nil {
+		return nil, err
+	}
+
+	if nodeID := os.Getenv("NODE_ID"); nodeID != "" {
+		cfg.NodeID = nodeID
+	}
+
+	for name, value := range flags {
+		err := cfg.setFlag(name, value)
+		if err != nil {
+			return nil, fmt.Errorf("-%s: %s", name, err)
+		}
+	}
+
+	err = cfg.finish()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+//加载配置文件，默认的配置文件可以不存在
+func (cfg *Config) loadFile(path string, explicit bool) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	values, err := parseTOML(file)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	for key, value := range values {
+		err := cfg.setKey(key, value.Value)
+		if err != nil {
+			return fmt.Errorf("%s: line %d: %s", path, value.Line, err)
+		}
+	}
+
+	return nil
+}
+
+//配置文件中的一项
+func (cfg *Config) setKey(key string, value interface{}) error {
+	switch key {
+	case "seeds":
+		seeds, ok := value.([]string)
+		if !ok {
+			return fmt.Errorf("%s must be an array of strings", key)
+		}
+		cfg.Seeds = seeds
+	case "rpc.enabled":
+		enabled, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("%s must be true or false", key)
+		}
+		cfg.RPCEnabled = enabled
+	case "banscore", "bantime":
+		n, ok := value.(int64)
+		if !ok {
+			return fmt.Errorf("%s must be an integer", key)
+		}
+		return cfg.setInt(key, n)
+	case "nodeid":
+		//节点 ID 可以写成端口号
+		if port, ok := value.(int64); ok {
+			value = strconv.FormatInt(port, 10)
+		}
+		fallthrough
+	default:
+		field := cfg.stringField(key)
+		if field == nil {
+			return fmt.Errorf("unknown key %q", key)
+		}
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", key)
+		}
+		*field = s
+	}
+
+	return nil
+}
+
+//命令行参数，-seeds 是逗号分隔的地址
+func (cfg *Config) setFlag(name, value string) error {
+	switch name {
+	case "seeds":
+		cfg.Seeds = splitList(value)
+	case "rpc":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		cfg.RPCEnabled = enabled
+	case "rpclisten":
+		cfg.RPCListen = value
+	case "banscore", "bantime":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		return cfg.setInt(name, n)
+	default:
+		field := cfg.stringField(name)
+		if field == nil {
+			return errors.New("unknown option")
+		}
+		*field = value
+	}
+
+	return nil
+}
+
+//banscore 是违规分数，bantime 是禁止的秒数
+func (cfg *Config) setInt(key string, n int64) error {
+	if n <= 0 {
+		return fmt.Errorf("%s must be positive", key)
+	}
+
+	switch key {
+	case "banscore":
+		cfg.BanScore = int(n)
+	case "bantime":
+		cfg.BanTime = time.Duration(n) * time.Second
+	}
+
+	return nil
+}
+
+func (cfg *Config) stringField(key string) *string {
+	switch key {
+	case "network":
+		return &cfg.Network
+	case "datadir":
+		return &cfg.DataDir
+	case "nodeid":
+		return &cfg.NodeID
+	case "listen":
+		return &cfg.Listen
+	case "external":
+		return &cfg.External
+	case "miner":
+		return &cfg.Miner
+	case "loglevel":
+		return &cfg.LogLevel
+	case "rpc.listen":
+		return &cfg.RPCListen
+	case "rpc.password", "rpcpassword":
+		return &cfg.RPCPassword
+	}
+
+	return nil
+}
+
+//检查配置，补全未设置的节点 ID 和地址：
+//节点 ID 默认是监听地址的端口，监听地址默认是 localhost:<节点 ID>，对外地址默认是监听地址
+func (cfg *Config) finish() error {
+	if _, ok := chainParams[cfg.Network]; !ok {
+		return fmt.Errorf("Unknown network %q, use one of %v.", cfg.Network, networkNames())
+	}
+	if _, err := ParseLogLevel(cfg.LogLevel); err != nil {
+		return err
+	}
+
+	if cfg.Listen != "" {
+		_, port, err := net.SplitHostPort(cfg.Listen)
+		if err != nil {
+			return fmt.Errorf("Listen address is not valid: %s", err)
+		}
+		if cfg.NodeID == "" {
+			cfg.NodeID = port
+		}
+	}
+	if cfg.NodeID == "" {
+		return errors.New("Node ID is not set, use -nodeid, the NODE_ID env. var or nodeid in the config file.")
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = fmt.Sprintf("localhost:%s", cfg.NodeID)
+	}
+	if cfg.External == "" {
+		cfg.External = cfg.Listen
+	}
+	//cookie 只能被本机的客户端读取，监听其他地址时必须设置密码
+	if cfg.RPCEnabled && cfg.RPCListen != "" && cfg.RPCPassword == "" && !isLoopbackAddress(cfg.RPCListen) {
+		return fmt.Errorf("RPC address %s is not a loopback address, set rpc.password to serve RPC on it.", cfg.RPCListen)
+	}
+
+	return os.MkdirAll(cfg.DataDir, 0700)
+}
+
+//使配置生效：选择网络、设置种子节点和日志级别
+func (cfg *Config) Apply() {
+	err := SelectNetwork(cfg.Network)
+	if err != nil {
+		log.Panic(err)
+	}
+	if len(cfg.Seeds) > 0 {
+		knownNodes = append([]string(nil), cfg.Seeds...)
+	}
+
+	activeLogLevel, _ = ParseLogLevel(cfg.LogLevel)
+	activeConfig = cfg
+}
+
+//地址的主机是 localhost 或回环 IP
+func isLoopbackAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+//区块链数据库文件的路径
+func dbPath(nodeID string) string {
+	return filepath.Join(activeConfig.DataDir, fmt.Sprintf(activeNetParams.DBFile, nodeID))
+}
+
+//钱包文件的路径
+func walletPath(nodeID string) string {
+	return filepath.Join(activeConfig.DataDir, fmt.Sprintf(activeNetParams.WalletFile, nodeID))
+}
+
+//RPC cookie 文件的路径
+func rpcCookiePath(nodeID string) string {
+	return filepath.Join(activeConfig.DataDir, fmt.Sprintf(activeNetParams.RPCCookieFile, nodeID))
+}
+
+//已知节点地址文件的路径
+func peersPath(nodeID string) string {
+	return filepath.Join(activeConfig.DataDir, fmt.Sprintf(activeNetParams.PeersFile, nodeID))
+}
+
+//禁止列表文件的路径
+func banListPath(nodeID string) string {
+	return filepath.Join(activeConfig.DataDir, fmt.Sprintf(activeNetParams.BanListFile, nodeID))
+}
+
+//先写入临时文件再替换，避免写入中断时损坏原来的文件；上次留下的临时文件先删除，写入后文件的权限总是 perm
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpFile := path + ".tmp"
+	os.Remove(tmpFile)
+	err := ioutil.WriteFile(tmpFile, data, perm)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile, path)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//在临时的数据目录中写入默认配置文件
+func writeTestConfig(t *testing.T, content string) string {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, defaultConfigFile), []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+//默认值 < 配置文件 < NODE_ID 环境变量 < 命令行参数
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir := writeTestConfig(t, "network = \"testnet\"\nnodeid = \"1\"\nminer = \"file\"\nloglevel = \"warn\"\n\n[rpc]\nlisten = \"localhost:9\"\n")
+
+	t.Setenv("NODE_ID", "")
+	cfg, err := LoadConfig("", map[string]string{"datadir": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Network != "testnet" || cfg.NodeID != "1" || cfg.Miner != "file" || cfg.LogLevel != "warn" || cfg.RPCListen != "localhost:9" {
+		t.Errorf("config file is not applied: %+v", cfg)
+	}
+	if !cfg.RPCEnabled || cfg.BanScore != defaultBanScore {
+		t.Errorf("defaults are not kept: %+v", cfg)
+	}
+
+	t.Setenv("NODE_ID", "2")
+	cfg, err = LoadConfig("", map[string]string{"datadir": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.NodeID != "2" || cfg.Listen != "localhost:2" || cfg.External != "localhost:2" {
+		t.Errorf("NODE_ID does not override the config file: %+v", cfg)
+	}
+
+	cfg, err = LoadConfig("", map[string]string{"datadir": dir, "nodeid": "3", "loglevel": "debug", "rpc": "false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.NodeID != "3" || cfg.LogLevel != "debug" || cfg.RPCEnabled || cfg.Miner != "file" {
+		t.Errorf("flags do not override the environment and the config file: %+v", cfg)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	t.Setenv("NODE_ID", "")
+
+	dir := writeTestConfig(t, "nodeid = 3000\n\nbogus = 1\n")
+	_, err := LoadConfig("", map[string]string{"datadir": dir})
+	expectError(t, err, "line 3: unknown key")
+
+	dir = writeTestConfig(t, "banscore = \"high\"\n")
+	_, err = LoadConfig("", map[string]string{"datadir": dir, "nodeid": "3000"})
+	expectError(t, err, "must be an integer")
+
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.conf"), map[string]string{"nodeid": "3000"})
+	if !os.IsNotExist(err) {
+		t.Errorf("expected a missing explicit config file to fail, got %v", err)
+	}
+
+	_, err = LoadConfig("", map[string]string{"datadir": t.TempDir(), "network": "simnet", "nodeid": "3000"})
+	expectError(t, err, "Unknown network")
+
+	_, err = LoadConfig("", map[string]string{"datadir": t.TempDir()})
+	expectError(t, err, "Node ID is not set")
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.dat")
+	if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	//上次中断时留下的临时文件
+	if err := ioutil.WriteFile(path+".tmp", []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil || string(content) != "new" {
+		t.Errorf("read %q, %v", content, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("file mode is %v, %v", info.Mode().Perm(), err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temporary file is left behind")
+	}
+}
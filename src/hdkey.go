@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"github.com/tyler-smith/go-bip39"
+	"log"
+	"math/big"
+)
+
+//分层确定性（HD）密钥派生，算法与 BIP32 相同，按照 SLIP-0010 应用在钱包使用的 P-256 曲线上
+//所有地址都由同一个种子派生，因此只需要备份一次助记词
+const hardenedKeyStart = 0x80000000
+
+//SLIP-0010 中 P-256 曲线主密钥使用的 HMAC 密钥
+var masterKeySalt = []byte("Nist256p1 seed")
+
+//扩展私钥：私钥加上用于派生子密钥的链码
+type ExtendedKey struct {
+	Key       []byte
+	ChainCode []byte
+	Depth     uint8
+	Index     uint32
+}
+
+//由种子生成主密钥
+func NewMasterKey(seed []byte) *ExtendedKey {
+	n := elliptic.P256().Params().N
+	data := seed
+
+	for {
+		mac := hmac.New(sha512.New, masterKeySalt)
+		mac.Write(data)
+		I := mac.Sum(nil)
+
+		//私钥必须在 [1, n-1] 之间，否则用结果重新计算
+		key := new(big.Int).SetBytes(I[:32])
+		if key.Sign() != 0 && key.Cmp(n) < 0 {
+			return &ExtendedKey{I[:32], I[32:], 0, 0}
+		}
+		data = I
+	}
+}
+
+//派生第 index 个子私钥，index 不小于 hardenedKeyStart 时为强化派生
+//强化派生只使用私钥，普通派生使用压缩格式的公钥
+func (k *ExtendedKey) Child(index uint32) *ExtendedKey {
+	curve := elliptic.P256()
+	n := curve.Params().N
+
+	var data []byte
+	if index >= hardenedKeyStart {
+		data = append([]byte{0x00}, k.Key...)
+	} else {
+		x, y := curve.ScalarBaseMult(k.Key)
+		data = elliptic.MarshalCompressed(curve, x, y)
+	}
+	data = append(data, ser32(index)...)
+
+	for {
+		mac := hmac.New(sha512.New, k.ChainCode)
+		mac.Write(data)
+		I := mac.Sum(nil)
+
+		il := new(big.Int).SetBytes(I[:32])
+		child := new(big.Int).Add(il, new(big.Int).SetBytes(k.Key))
+		child.Mod(child, n)
+
+		//结果无效时按照 SLIP-0010 使用 0x01 || IR || index 重新计算
+		if il.Cmp(n) < 0 && child.Sign() != 0 {
+			return &ExtendedKey{child.FillBytes(make([]byte, 32)), I[32:], k.Depth + 1, index}
+		}
+		data = append([]byte{0x01}, I[32:]...)
+		data = append(data, ser32(index)...)
+	}
+}
+
+//按路径依次派生子密钥
+func (k *ExtendedKey) Derive(path []uint32) *ExtendedKey {
+	key := k
+	for _, index := range path {
+		key = key.Child(index)
+	}
+
+	return key
+}
+
+//转换成 ECDSA 私钥
+func (k *ExtendedKey) PrivateKey() ecdsa.PrivateKey {
+	curve := elliptic.P256()
+	private := ecdsa.PrivateKey{}
+	private.Curve = curve
+	private.D = new(big.Int).SetBytes(k.Key)
+	private.X, private.Y = curve.ScalarBaseMult(k.Key)
+
+	return private
+}
+
+func ser32(i uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, i)
+
+	return b
+}
+
+//外部地址的派生路径 m/0'/0/i
+var hdAccountPath = []uint32{hardenedKeyStart + 0, 0}
+
+//恢复钱包时，连续 hdGapLimit 个地址都没有在链上出现过就停止查找
+const hdGapLimit = 20
+
+//助记词的熵长度，128 位对应 12 个单词
+const mnemonicEntropyBits = 128
+
+//生成新的 BIP39 助记词
+func NewMnemonic() string {
+	entropy, err := bip39.NewEntropy(mnemonicEntropyBits)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return mnemonic
+}
+
+//检查助记词的单词和校验和，并由它得到外部地址的父密钥
+func newAccountKey(mnemonic string) (*ExtendedKey, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMasterKey(seed).Derive(hdAccountPath), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+)
+
+//公钥和签名的编码
+//新的公钥使用 SEC1 压缩格式（0x02/0x03 + 32 字节的X坐标），签名使用固定 64 字节的 r || s
+//旧版本的公钥是 X.Bytes() || Y.Bytes()，坐标以 0 开头时长度会变短，
+//链上已有的输出锁定在这些公钥的哈希上，因此解析时仍然接受它们
+//旧版本的签名 r.Bytes() || s.Bytes() 不再接受：签名哈希已经改变，旧的签名本来就无法通过验证
+const compressedPubKeyLen = 33
+const uncompressedPubKeyLen = 65
+const coordinateLen = 32
+const signatureLen = 2 * coordinateLen
+
+var errInvalidPubKey = errors.New("Public key is not a valid point on the curve.")
+
+//公钥的编码：SEC1 压缩格式
+func encodePublicKey(public ecdsa.PublicKey) []byte {
+	return elliptic.MarshalCompressed(public.Curve, public.X, public.Y)
+}
+
+//旧版本的公钥编码，只用于恢复旧版本导出的私钥对应的地址
+func encodeLegacyPublicKey(public ecdsa.PublicKey) []byte {
+	return append(public.X.Bytes(), public.Y.Bytes()...)
+}
+
+//严格地解析公钥，只接受 SEC1 压缩格式、SEC1 未压缩格式和旧版本的坐标拼接格式，点必须在曲线上
+func ParsePubKey(pubKey []byte) (*ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+
+	switch {
+	case len(pubKey) == compressedPubKeyLen && (pubKey[0] == 0x02 || pubKey[0] == 0x03):
+		x, y := elliptic.UnmarshalCompressed(curve, pubKey)
+		if x == nil {
+			return nil, errInvalidPubKey
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case len(pubKey) == uncompressedPubKeyLen && pubKey[0] == 0x04:
+		x, y := elliptic.Unmarshal(curve, pubKey)
+		if x == nil {
+			return nil, errInvalidPubKey
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case len(pubKey) <= signatureLen:
+		return parseLegacyPubKey(pubKey)
+	}
+
+	return nil, errInvalidPubKey
+}
+
+//旧版本的公钥没有长度信息，依次尝试所有可能的分割位置，只有唯一一个位置得到曲线上的点时才接受
+func parseLegacyPubKey(pubKey []byte) (*ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+	var found *ecdsa.PublicKey
+
+	for _, split := range legacySplits(len(pubKey)) {
+		x := new(big.Int).SetBytes(pubKey[:split])
+		y := new(big.Int).SetBytes(pubKey[split:])
+		if !curve.IsOnCurve(x, y) {
+			continue
+		}
+		if found != nil {
+			return nil, errors.New("Public key encoding is ambiguous.")
+		}
+		found = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	}
+
+	if found == nil {
+		return nil, errInvalidPubKey
+	}
+
+	return found, nil
+}
+
+//旧版本编码中两个不超过 32 字节的数拼接成 length 字节时，第一个数可能的长度
+func legacySplits(length int) []int {
+	var splits []int
+
+	for split := length - coordinateLen; split <= coordinateLen; split++ {
+		if split > 0 && split < length {
+			splits = append(splits, split)
+		}
+	}
+
+	return splits
+}
+
+//签名的编码：r 和 s 各占 32 字节
+func encodeSignature(r, s *big.Int) []byte {
+	signature := make([]byte, signatureLen)
+	r.FillBytes(signature[:coordinateLen])
+	s.FillBytes(signature[coordinateLen:])
+
+	return signature
+}
+
+//验证签名
+//64 字节的签名是固定宽度的 r || s，更长的签名必须是严格的 DER 编码，其他长度的签名都无效
+func verifySignature(public *ecdsa.PublicKey, hash, signature []byte) bool {
+	switch {
+	case len(signature) == signatureLen:
+		r := new(big.Int).SetBytes(signature[:coordinateLen])
+		s := new(big.Int).SetBytes(signature[coordinateLen:])
+		return ecdsa.Verify(public, hash, r, s)
+	case len(signature) > signatureLen:
+		return ecdsa.VerifyASN1(public, hash, signature)
+	}
+
+	return false
+}
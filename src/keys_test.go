@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+//生成一个 X 或 Y 坐标以 0 开头的私钥，旧版本的公钥编码中这个坐标只有 31 字节
+func shortCoordinateKey(t *testing.T, shortX bool) *ecdsa.PrivateKey {
+	for i := 0; i < 20000; i++ {
+		private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		coordinate := private.Y
+		if shortX {
+			coordinate = private.X
+		}
+		if len(coordinate.Bytes()) == coordinateLen-1 {
+			return private
+		}
+	}
+	t.Fatal("no key with a short coordinate was found")
+
+	return nil
+}
+
+func TestParseShortCoordinatePubKey(t *testing.T) {
+	for _, shortX := range []bool{true, false} {
+		private := shortCoordinateKey(t, shortX)
+
+		legacy := encodeLegacyPublicKey(private.PublicKey)
+		if len(legacy) != signatureLen-1 {
+			t.Fatalf("legacy public key has %d bytes", len(legacy))
+		}
+
+		for _, pubKey := range [][]byte{legacy, encodePublicKey(private.PublicKey), elliptic.Marshal(elliptic.P256(), private.X, private.Y)} {
+			public, err := ParsePubKey(pubKey)
+			if err != nil {
+				t.Fatalf("short X %v, %d bytes: %s", shortX, len(pubKey), err)
+			}
+			if public.X.Cmp(private.X) != 0 || public.Y.Cmp(private.Y) != 0 {
+				t.Errorf("short X %v, %d bytes: parsed a different point", shortX, len(pubKey))
+			}
+		}
+	}
+}
+
+func TestParsePubKeyRejectsMalformed(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := encodePublicKey(private.PublicKey)
+	uncompressed := elliptic.Marshal(elliptic.P256(), private.X, private.Y)
+
+	wrongPrefix := append([]byte{0x05}, compressed[1:]...)
+	notOnCurve := append([]byte{}, uncompressed...)
+	notOnCurve[uncompressedPubKeyLen-1] ^= 0x01
+
+	for name, pubKey := range map[string][]byte{
+		"empty":        nil,
+		"one byte":     {0x02},
+		"34 bytes":     append(append([]byte{}, compressed...), 0x00),
+		"66 bytes":     append(append([]byte{}, uncompressed...), 0x00),
+		"wrong prefix": wrongPrefix,
+		"not on curve": notOnCurve,
+	} {
+		if _, err := ParsePubKey(pubKey); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestVerifySignatureEncodings(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("signature test"))
+
+	//r 以 0 开头的签名仍然是 64 字节
+	var r, s *big.Int
+	for i := 0; i < 20000; i++ {
+		r, s, err = ecdsa.Sign(rand.Reader, private, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Bytes()) < coordinateLen {
+			break
+		}
+	}
+	signature := encodeSignature(r, s)
+	if len(signature) != signatureLen {
+		t.Fatalf("signature has %d bytes", len(signature))
+	}
+	if !verifySignature(&private.PublicKey, hash[:], signature) {
+		t.Error("64-byte signature was rejected")
+	}
+
+	der, err := ecdsa.SignASN1(rand.Reader, private, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifySignature(&private.PublicKey, hash[:], der) {
+		t.Error("DER signature was rejected")
+	}
+
+	//旧版本不定长的 r.Bytes() || s.Bytes() 不再接受
+	legacy := append(r.Bytes(), s.Bytes()...)
+	for name, sig := range map[string][]byte{
+		"empty":    nil,
+		"legacy":   legacy,
+		"63 bytes": signature[1:],
+		"bad DER":  append(append([]byte{}, der...), 0x00),
+	} {
+		if len(sig) == signatureLen {
+			continue
+		}
+		if verifySignature(&private.PublicKey, hash[:], sig) {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	tampered := append([]byte{}, signature...)
+	tampered[0] ^= 0x01
+	if verifySignature(&private.PublicKey, hash[:], tampered) {
+		t.Error("tampered signature was accepted")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+//节点日志的级别，低于当前级别的日志不输出
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+var logLevels = map[string]LogLevel{
+	"debug": LogDebug,
+	"info":  LogInfo,
+	"warn":  LogWarn,
+	"error": LogError,
+}
+
+const defaultLogLevel = "info"
+
+//当前的日志级别，由配置文件的 loglevel 或命令行参数 -loglevel 设置
+var activeLogLevel = LogInfo
+
+func ParseLogLevel(name string) (LogLevel, error) {
+	level, ok := logLevels[name]
+	if !ok {
+		var names []string
+		for name := range logLevels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return 0, fmt.Errorf("Unknown log level %q, use one of %v.", name, names)
+	}
+
+	return level, nil
+}
+
+func logf(level LogLevel, format string, args ...interface{}) {
+	if level >= activeLogLevel {
+		fmt.Printf(format+"\n", args...)
+	}
+}
+
+//每条收到的消息等调试信息
+func logDebug(format string, args ...interface{}) {
+	logf(LogDebug, format, args...)
+}
+
+//新区块、新节点等正常运行的信息
+func logInfo(format string, args ...interface{}) {
+	logf(LogInfo, format, args...)
+}
+
+//被拒绝的区块和交易、无法连接的节点等
+func logWarn(format string, args ...interface{}) {
+	logf(LogWarn, format, args...)
+}
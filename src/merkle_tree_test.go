@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+func merkleTestHash(left, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, left...), right...))
+
+	return hash[:]
+}
+
+func merkleTestLeaf(datum []byte) []byte {
+	hash := sha256.Sum256(datum)
+
+	return hash[:]
+}
+
+func TestMerkleTreeRoot(t *testing.T) {
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+	ha, hb, hc := merkleTestLeaf(a), merkleTestLeaf(b), merkleTestLeaf(c)
+
+	//只有一笔交易时，它和自己的副本组成根节点
+	if root := NewMerkleTree([][]byte{a}).RootNode.Data; string(root) != string(merkleTestHash(ha, ha)) {
+		t.Errorf("1 leaf: %x", root)
+	}
+
+	//三笔交易时复制最后一笔
+	expected := merkleTestHash(merkleTestHash(ha, hb), merkleTestHash(hc, hc))
+	if root := NewMerkleTree([][]byte{a, b, c}).RootNode.Data; string(root) != string(expected) {
+		t.Errorf("3 leaves: %x", root)
+	}
+}
+
+func TestMerkleTreeOddLevels(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		var data [][]byte
+		for i := 0; i < n; i++ {
+			data = append(data, []byte(fmt.Sprintf("tx%d", i)))
+		}
+
+		root := NewMerkleTree(data).RootNode.Data
+		if len(root) != sha256.Size {
+			t.Errorf("%d leaves: root has %d bytes", n, len(root))
+		}
+	}
+
+	//六笔交易时第二层有三个节点，复制其中最后一个
+	var data [][]byte
+	var leaves [][]byte
+	for i := 0; i < 6; i++ {
+		data = append(data, []byte(fmt.Sprintf("tx%d", i)))
+		leaves = append(leaves, merkleTestLeaf(data[i]))
+	}
+	h01 := merkleTestHash(leaves[0], leaves[1])
+	h23 := merkleTestHash(leaves[2], leaves[3])
+	h45 := merkleTestHash(leaves[4], leaves[5])
+	expected := merkleTestHash(merkleTestHash(h01, h23), merkleTestHash(h45, h45))
+	if root := NewMerkleTree(data).RootNode.Data; string(root) != string(expected) {
+		t.Errorf("6 leaves: %x", root)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"log"
+	"math/big"
+)
+
+//签名消息的哈希前面加上这个前缀，签出的消息不可能同时是一笔有效的交易
+const messageMagic = "BlockChain_Go Signed Message:\n"
+
+//可恢复签名的第一个字节：messageHeaderBase + 4*公钥格式 + 恢复序号
+//恢复序号的第 0 位是 R 点Y坐标的奇偶性，第 1 位表示 R 的X坐标是否超过了 n
+//Schnorr 公钥无法从签名中恢复，签名中直接带上 32 字节的公钥
+const messageHeaderBase = 27
+
+//可恢复签名中记录的公钥格式，恢复出的点按照这个格式编码后才能得到与地址相同的哈希
+const (
+	messageKeyLegacy byte = iota
+	messageKeyP256
+	messageKeySecp256k1
+	messageKeySchnorr
+)
+
+const messageSignatureLen = 1 + signatureLen
+
+var errInvalidMessageSignature = errors.New("Message signature is malformed.")
+
+//消息的哈希：SHA256(SHA256(len(magic) || magic || len(message) || message))
+//长度使用 varint 编码
+func messageHash(message string) []byte {
+	var buf bytes.Buffer
+	for _, part := range []string{messageMagic, message} {
+		length := make([]byte, binary.MaxVarintLen64)
+		buf.Write(length[:binary.PutUvarint(length, uint64(len(part)))])
+		buf.WriteString(part)
+	}
+
+	first := sha256.Sum256(buf.Bytes())
+	second := sha256.Sum256(first[:])
+
+	return second[:]
+}
+
+//公钥对应的格式
+func messageKeyFormat(keyType KeyType, pubKey []byte) byte {
+	switch {
+	case keyType == KeyTypeSecp256k1:
+		return messageKeySecp256k1
+	case keyType == KeyTypeSchnorr:
+		return messageKeySchnorr
+	case len(pubKey) == compressedPubKeyLen:
+		return messageKeyP256
+	}
+
+	return messageKeyLegacy
+}
+
+//用钱包的私钥签名消息，返回 Base64 编码的可恢复签名
+func (w *Wallet) SignMessage(message string) string {
+	hash := messageHash(message)
+	signer := w.Signer()
+	signature := signer.Sign(hash)
+	format := messageKeyFormat(w.KeyType, w.PublicKey)
+
+	if format == messageKeySchnorr {
+		header := []byte{messageHeaderBase + 4*format}
+		encoded := append(append(header, signer.PublicKey()[1:]...), signature...)
+		return base64.StdEncoding.EncodeToString(encoded)
+	}
+
+	//ECDSA 签名本身不包含恢复序号，依次尝试，直到恢复出自己的公钥
+	for recID := byte(0); recID < 4; recID++ {
+		encoded := append([]byte{messageHeaderBase + 4*format + recID}, signature...)
+		pubKey, err := recoverMessagePubKey(encoded, hash)
+		if err == nil && bytes.Equal(pubKey, w.PublicKey) {
+			return base64.StdEncoding.EncodeToString(encoded)
+		}
+	}
+
+	log.Panic("ERROR: Could not compute the recovery id of the message signature")
+	return ""
+}
+
+//验证 address 的持有者签名了 message：从签名中恢复公钥，公钥的哈希必须与地址中的哈希相同
+func VerifyMessage(address, signature, message string) (bool, error) {
+	pubKeyHash, err := DecodeAddress(address)
+	if err != nil {
+		return false, err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false, err
+	}
+
+	hash := messageHash(message)
+	pubKey, err := recoverMessagePubKey(decoded, hash)
+	if err != nil {
+		return false, err
+	}
+
+	//恢复出的公钥总是满足签名等式，再用交易签名的规则验证一次，拒绝 s 过大等非标准签名
+	verifier, err := ParseVerifier(pubKey)
+	if err != nil {
+		return false, err
+	}
+	if !verifier.Verify(hash, decoded[len(decoded)-signatureLen:]) {
+		return false, nil
+	}
+
+	return bytes.Equal(HashPubKey(pubKey), pubKeyHash), nil
+}
+
+//从可恢复签名中得到签名者的公钥，公钥按照签名头中的格式编码
+func recoverMessagePubKey(signature, hash []byte) ([]byte, error) {
+	if len(signature) == 0 || signature[0] < messageHeaderBase {
+		return nil, errInvalidMessageSignature
+	}
+	format := (signature[0] - messageHeaderBase) / 4
+	recID := (signature[0] - messageHeaderBase) % 4
+
+	switch format {
+	case messageKeySchnorr:
+		if len(signature) != 1+schnorrPubKeyLen+signatureLen || recID != 0 {
+			return nil, errInvalidMessageSignature
+		}
+		return append([]byte{byte(KeyTypeSchnorr)}, signature[1:1+schnorrPubKeyLen]...), nil
+	case messageKeyLegacy, messageKeyP256, messageKeySecp256k1:
+	default:
+		return nil, errInvalidMessageSignature
+	}
+	if len(signature) != messageSignatureLen {
+		return nil, errInvalidMessageSignature
+	}
+
+	keyType := KeyTypeP256
+	if format == messageKeySecp256k1 {
+		keyType = KeyTypeSecp256k1
+	}
+	public, err := recoverPublicKey(keyType.Curve(), signature[1:], hash, recID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case messageKeyLegacy:
+		return encodeLegacyPublicKey(*public), nil
+	case messageKeySecp256k1:
+		return encodeTypedPublicKey(KeyTypeSecp256k1, *public), nil
+	}
+
+	return encodePublicKey(*public), nil
+}
+
+//ECDSA 公钥恢复：R 是X坐标为 r + (recID>>1)*n、奇偶性为 recID&1 的点，
+//由 s*R = e*G + r*Q 得到 Q = r^-1 * (s*R - e*G)
+func recoverPublicKey(curve elliptic.Curve, signature, hash []byte, recID byte) (*ecdsa.PublicKey, error) {
+	params := curve.Params()
+	N := params.N
+
+	r := new(big.Int).SetBytes(signature[:coordinateLen])
+	s := new(big.Int).SetBytes(signature[coordinateLen:])
+	if r.Sign() == 0 || r.Cmp(N) >= 0 || s.Sign() == 0 || s.Cmp(N) >= 0 {
+		return nil, errInvalidMessageSignature
+	}
+
+	x := new(big.Int).Set(r)
+	if recID&2 != 0 {
+		x.Add(x, N)
+	}
+	if x.Cmp(params.P) >= 0 {
+		return nil, errInvalidMessageSignature
+	}
+
+	compressed := append([]byte{0x02 + recID&1}, x.FillBytes(make([]byte, coordinateLen))...)
+	var rx, ry *big.Int
+	if curve == secp256k1 {
+		rx, ry = unmarshalSecp256k1(compressed)
+	} else {
+		rx, ry = elliptic.UnmarshalCompressed(curve, compressed)
+	}
+	if rx == nil {
+		return nil, errInvalidMessageSignature
+	}
+
+	rInv := new(big.Int).ModInverse(r, N)
+	u1 := new(big.Int).SetBytes(hash)
+	u1.Neg(u1)
+	u1.Mul(u1, rInv)
+	u1.Mod(u1, N)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, N)
+
+	x1, y1 := curve.ScalarBaseMult(u1.Bytes())
+	x2, y2 := curve.ScalarMult(rx, ry, u2.Bytes())
+	qx, qy := curve.Add(x1, y1, x2, y2)
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil, errInvalidMessageSignature
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: qx, Y: qy}, nil
+}
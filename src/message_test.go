@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+//每种公钥格式的钱包，旧钱包的 P-256 公钥没有压缩
+func messageTestWallets() map[string]*Wallet {
+	legacy := NewWallet()
+	legacy.PublicKey = encodeLegacyPublicKey(legacy.PrivateKey.PublicKey)
+
+	return map[string]*Wallet{
+		"legacy":    legacy,
+		"p256":      NewWalletWithKeyType(KeyTypeP256),
+		"secp256k1": NewWalletWithKeyType(KeyTypeSecp256k1),
+		"schnorr":   NewWalletWithKeyType(KeyTypeSchnorr),
+	}
+}
+
+func TestSignAndVerifyMessage(t *testing.T) {
+	message := "I own this address"
+	other := string(NewWallet().GetAddress())
+
+	for name, wallet := range messageTestWallets() {
+		signature := wallet.SignMessage(message)
+
+		for _, address := range []string{string(wallet.GetAddress()), string(wallet.GetBech32Address())} {
+			ok, err := VerifyMessage(address, signature, message)
+			if err != nil || !ok {
+				t.Errorf("%s: signature is not valid for %s: %v", name, address, err)
+			}
+		}
+
+		if ok, _ := VerifyMessage(string(wallet.GetAddress()), signature, message+"!"); ok {
+			t.Errorf("%s: signature is valid for another message", name)
+		}
+		if ok, _ := VerifyMessage(other, signature, message); ok {
+			t.Errorf("%s: signature is valid for another address", name)
+		}
+	}
+}
+
+func TestVerifyMessageRejectsMalformedSignatures(t *testing.T) {
+	wallet := NewWalletWithKeyType(KeyTypeSecp256k1)
+	address := string(wallet.GetAddress())
+	message := "hello"
+	decoded, _ := base64.StdEncoding.DecodeString(wallet.SignMessage(message))
+
+	header := append([]byte{}, decoded...)
+	header[0] = messageHeaderBase - 1
+	schnorrHeader := append([]byte{}, decoded...)
+	schnorrHeader[0] = messageHeaderBase + 4*messageKeySchnorr
+
+	signatures := map[string]string{
+		"empty":             "",
+		"not base64":        "!!!",
+		"truncated":         base64.StdEncoding.EncodeToString(decoded[:len(decoded)-1]),
+		"header below base": base64.StdEncoding.EncodeToString(header),
+		"wrong key format":  base64.StdEncoding.EncodeToString(schnorrHeader),
+	}
+	for name, signature := range signatures {
+		if ok, err := VerifyMessage(address, signature, message); ok || err == nil {
+			t.Errorf("%s: expected an error, got %v, %v", name, ok, err)
+		}
+	}
+
+	if _, err := VerifyMessage("not an address", wallet.SignMessage(message), message); err == nil {
+		t.Error("invalid address accepted")
+	}
+}
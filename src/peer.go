@@ -0,0 +1,451 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+//节点之间保持长连接，每个连接是一个 Peer：
+//连接建立后双方先交换 version 和 verack 消息完成握手，握手之前收到其他消息会断开连接
+//读和写各用一个 goroutine，发送的消息先放进发送队列，写 goroutine 依次写入连接
+//写 goroutine 每隔 pingInterval 发送一次 ping，下一次发送时还没有收到 pong 就断开连接
+const (
+	targetOutbound   = 8
+	maxInbound       = 32
+	sendQueueSize    = 100
+	dialTimeout      = 10 * time.Second
+	handshakeTimeout = 30 * time.Second
+	pingInterval     = 2 * time.Minute
+	idleTimeout      = 5 * time.Minute
+	writeTimeout     = 30 * time.Second
+	connectInterval  = 30 * time.Second
+
+	//每个连接最多记住这么多条对方已知的清单，超过后忘记最早的
+	maxKnownInventory = 5000
+)
+
+//本节点的随机数，version 消息中带着它，收到相同的随机数说明连接到了自己
+var localNonce = randomNonce()
+
+//保护 mempool 和 blockInTransit，所有连接的消息依次处理
+var nodeMu sync.Mutex
+
+type Peer struct {
+	conn      net.Conn
+	addr      string
+	inbound   bool
+	sendQueue chan *message
+	quit      chan struct{}
+	closeOnce sync.Once
+
+	mu              sync.Mutex
+	versionReceived bool
+	verackReceived  bool
+	version         int
+	bestHeight      int
+	pingNonce       uint64
+	pingOutstanding bool
+	banScore        int
+	addrAdded       int
+
+	//对方已经知道的块和交易：对方发来的，或者已经发给对方的，转发时跳过它们
+	knownInventory      map[string]bool
+	knownInventoryOrder []string
+}
+
+func newPeer(conn net.Conn, addr string, inbound bool) *Peer {
+	return &Peer{
+		conn:      conn,
+		addr:      addr,
+		inbound:   inbound,
+		sendQueue: make(chan *message, sendQueueSize),
+		quit:      make(chan struct{}),
+
+		knownInventory: make(map[string]bool),
+	}
+}
+
+//出站连接是连接的地址，入站连接是连接的对方地址，不使用对方在 version 中声明的地址
+func (p *Peer) Addr() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.addr
+}
+
+func (p *Peer) String() string {
+	if p.inbound {
+		return p.Addr() + " (inbound)"
+	}
+
+	return p.Addr()
+}
+
+func (p *Peer) HandshakeDone() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.versionReceived && p.verackReceived
+}
+
+//对方的协议版本是否支持紧凑区块
+func (p *Peer) SupportsCompactBlocks() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.version >= compactBlocksVersion
+}
+
+//禁止列表中对方的地址，即连接的对方 IP
+func (p *Peer) BanAddress() string {
+	return banAddress(p.conn.RemoteAddr().String())
+}
+
+//增加对方的违规分数，达到 banscore 时禁止对方的 IP 并返回错误，读 goroutine 随后断开连接
+func (p *Peer) Misbehaving(m *Misbehavior) error {
+	p.mu.Lock()
+	p.banScore += m.Score
+	score := p.banScore
+	p.mu.Unlock()
+
+	logWarn("Misbehavior of %s (%d/%d): %s", p, score, activeConfig.BanScore, m.Reason)
+	if score < activeConfig.BanScore {
+		return nil
+	}
+
+	banManager.Ban(p.BanAddress(), activeConfig.BanTime, m.Reason)
+	peerManager.DisconnectAddress(p.BanAddress())
+
+	return fmt.Errorf("banned for %s", m.Reason)
+}
+
+//记录对方已经知道的块或交易
+func (p *Peer) AddKnownInventory(kind string, id []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := inventoryKey(kind, id)
+	if p.knownInventory[key] {
+		return
+	}
+	if len(p.knownInventoryOrder) >= maxKnownInventory {
+		delete(p.knownInventory, p.knownInventoryOrder[0])
+		p.knownInventoryOrder = p.knownInventoryOrder[1:]
+	}
+	p.knownInventory[key] = true
+	p.knownInventoryOrder = append(p.knownInventoryOrder, key)
+}
+
+func (p *Peer) KnowsInventory(kind string, id []byte) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.knownInventory[inventoryKey(kind, id)]
+}
+
+func inventoryKey(kind string, id []byte) string {
+	return kind + ":" + hex.EncodeToString(id)
+}
+
+//启动读写 goroutine
+func (p *Peer) Start(bc *Blockchain) {
+	go p.readLoop(bc)
+	go p.writeLoop()
+}
+
+//把消息放进发送队列，队列满了说明对方太慢，断开连接
+func (p *Peer) Send(command string, payload []byte) {
+	select {
+	case <-p.quit:
+	case p.sendQueue <- &message{command, payload}:
+	default:
+		p.Disconnect(errors.New("send queue is full"))
+	}
+}
+
+//断开连接并从节点管理器中删除，可以多次调用
+func (p *Peer) Disconnect(reason error) {
+	p.closeOnce.Do(func() {
+		close(p.quit)
+		p.conn.Close()
+		peerManager.remove(p)
+
+		if reason == nil || reason == io.EOF {
+			logInfo("Disconnected from %s", p)
+		} else {
+			logWarn("Disconnected from %s: %s", p, reason)
+		}
+	})
+}
+
+func (p *Peer) readLoop(bc *Blockchain) {
+	for {
+		timeout := idleTimeout
+		if !p.HandshakeDone() {
+			timeout = handshakeTimeout
+		}
+		p.conn.SetReadDeadline(time.Now().Add(timeout))
+
+		msg, err := readMessage(p.conn)
+		if err != nil {
+			p.Disconnect(err)
+			return
+		}
+
+		err = handleMessage(p, msg, bc)
+		if err != nil {
+			p.Disconnect(err)
+			return
+		}
+	}
+}
+
+func (p *Peer) writeLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-p.sendQueue:
+			p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			err := writeMessage(p.conn, msg.Command, msg.Payload)
+			if err != nil {
+				p.Disconnect(err)
+				return
+			}
+		case <-ticker.C:
+			err := p.ping()
+			if err != nil {
+				p.Disconnect(err)
+				return
+			}
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+func (p *Peer) ping() error {
+	p.mu.Lock()
+	if p.pingOutstanding {
+		p.mu.Unlock()
+		return errors.New("ping timeout")
+	}
+	p.pingNonce = randomNonce()
+	p.pingOutstanding = true
+	nonce := p.pingNonce
+	p.mu.Unlock()
+
+	p.Send("ping", gobEncode(ping{nonce}))
+
+	return nil
+}
+
+//管理所有连接，保持 targetOutbound 个出站连接，入站连接最多 maxInbound 个
+type PeerManager struct {
+	mu    sync.Mutex
+	peers map[*Peer]bool
+}
+
+var peerManager = &PeerManager{peers: make(map[*Peer]bool)}
+
+//添加一个连接，入站连接已满时返回 false
+func (pm *PeerManager) add(p *Peer) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if p.inbound && pm.count(true) >= maxInbound {
+		return false
+	}
+	pm.peers[p] = true
+
+	return true
+}
+
+func (pm *PeerManager) remove(p *Peer) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	delete(pm.peers, p)
+}
+
+func (pm *PeerManager) count(inbound bool) int {
+	n := 0
+	for p := range pm.peers {
+		if p.inbound == inbound {
+			n++
+		}
+	}
+
+	return n
+}
+
+//完成握手的连接
+func (pm *PeerManager) Peers() []*Peer {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	var peers []*Peer
+	for p := range pm.peers {
+		if p.HandshakeDone() {
+			peers = append(peers, p)
+		}
+	}
+
+	return peers
+}
+
+//是否已经和 addr 建立了连接
+func (pm *PeerManager) Connected(addr string) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for p := range pm.peers {
+		if p.Addr() == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+//断开来自被禁止地址的所有连接
+func (pm *PeerManager) DisconnectAddress(address string) {
+	pm.mu.Lock()
+	var peers []*Peer
+	for p := range pm.peers {
+		if p.BanAddress() == address {
+			peers = append(peers, p)
+		}
+	}
+	pm.mu.Unlock()
+
+	for _, p := range peers {
+		p.Disconnect(errors.New("address is banned"))
+	}
+}
+
+func (pm *PeerManager) OutboundCount() int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	return pm.count(false)
+}
+
+//接受一个入站连接，对方会先发送 version
+//被禁止的 IP 在握手之前就断开
+func (pm *PeerManager) Accept(conn net.Conn, bc *Blockchain) {
+	if banManager.IsBanned(banAddress(conn.RemoteAddr().String())) {
+		logDebug("Rejected connection from banned %s", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
+	p := newPeer(conn, conn.RemoteAddr().String(), true)
+	if !pm.add(p) {
+		logWarn("Rejected connection from %s: too many inbound peers", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
+	p.Start(bc)
+}
+
+//连接 addr 并发送 version 开始握手
+func (pm *PeerManager) Connect(addr string, bc *Blockchain) error {
+	conn, err := net.DialTimeout(protocol, addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	if banManager.IsBanned(banAddress(conn.RemoteAddr().String())) {
+		conn.Close()
+		return errors.New("address is banned")
+	}
+
+	p := newPeer(conn, addr, false)
+	pm.add(p)
+	p.Start(bc)
+	sendVersion(p, bc)
+
+	return nil
+}
+
+//每隔 connectInterval 检查一次出站连接，不足 targetOutbound 个时连接地址管理器中的其他地址
+func (pm *PeerManager) Run(bc *Blockchain) {
+	for {
+		pm.connectOutbound(bc)
+		time.Sleep(connectInterval)
+	}
+}
+
+func (pm *PeerManager) connectOutbound(bc *Blockchain) {
+	for _, node := range addrManager.Candidates() {
+		if pm.OutboundCount() >= targetOutbound {
+			return
+		}
+		if node == nodeAddress || pm.Connected(node) {
+			continue
+		}
+
+		addrManager.Attempt(node)
+		err := pm.Connect(node, bc)
+		if err != nil {
+			logWarn("%s is not available", node)
+		}
+	}
+}
+
+//命令行不运行节点，它连接 addr 完成握手后发送一笔交易，然后断开连接
+func relayTransaction(addr string, tnx *Transaction, bc *Blockchain) error {
+	conn, err := net.DialTimeout(protocol, addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	//命令行没有监听地址，AddrFrom 为空，对方不会把它当作节点连接
+	err = writeMessage(conn, "version", gobEncode(verzion{nodeVersion, bc.GetBestHeight(), "", randomNonce()}))
+	if err != nil {
+		return err
+	}
+
+	versionReceived, verackReceived := false, false
+	for !versionReceived || !verackReceived {
+		msg, err := readMessage(conn)
+		if err != nil {
+			return err
+		}
+
+		switch msg.Command {
+		case "version":
+			versionReceived = true
+			err = writeMessage(conn, "verack", nil)
+			if err != nil {
+				return err
+			}
+		case "verack":
+			verackReceived = true
+		}
+	}
+
+	return writeMessage(conn, "tx", gobEncode(tx{"", tnx.Serialize()}))
+}
+
+func randomNonce() uint64 {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return binary.LittleEndian.Uint64(b)
+}
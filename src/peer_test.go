@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+//测试用的一对 TCP 连接，返回本节点一侧和对方一侧
+func testConnPair(t *testing.T) (net.Conn, net.Conn) {
+	ln, err := net.Listen(protocol, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	remote, err := net.Dial(protocol, ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		remote.Close()
+	})
+
+	return conn, remote
+}
+
+//入站连接声明的监听地址只加入地址管理器，不会成为连接的标识
+func TestInboundPeerKeepsRemoteAddress(t *testing.T) {
+	bc, _ := newTestBlockchain(t)
+	saved := addrManager
+	addrManager = NewAddrManager("")
+	defer func() { addrManager = saved }()
+
+	conn, _ := testConnPair(t)
+	p := newPeer(conn, conn.RemoteAddr().String(), true)
+
+	claimed := "192.0.2.1:3000"
+	err := handleVersion(p, gobEncode(verzion{nodeVersion, 0, claimed, randomNonce()}), bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Addr() != conn.RemoteAddr().String() {
+		t.Errorf("inbound peer is identified as %s", p.Addr())
+	}
+	if p.BanAddress() != "127.0.0.1" {
+		t.Errorf("inbound peer is banned as %s", p.BanAddress())
+	}
+	if addrManager.Count() != 1 || addrManager.addrs[claimed] == nil {
+		t.Errorf("advertised address is not added to the address manager")
+	}
+}
@@ -12,9 +12,6 @@ var (
 	maxNonce = math.MaxInt64
 )
 
-//即挖矿的难度系数，也就是开头会有多少个0
-const targetBits = 16
-
 type ProofOfWork struct {
 	block  *Block
 	target *big.Int
@@ -23,7 +20,8 @@ type ProofOfWork struct {
 //256是一个SHA-256哈希的位数，左移（256-tagetBits）位
 func NewProofOfWork(b *Block) *ProofOfWork {
 	target := big.NewInt(1)
-	target.Lsh(target, uint(256-targetBits))
+	//即挖矿的难度系数，也就是开头会有多少个0，由当前网络决定
+	target.Lsh(target, uint(256-activeNetParams.TargetBits))
 
 	pow := &ProofOfWork{b, target}
 
@@ -36,7 +34,7 @@ func (pow *ProofOfWork) prepareData(nonce int) []byte {
 			pow.block.PrevBlockHash,
 			pow.block.HashTransactions(),
 			IntToHex(pow.block.Timestamp),
-			IntToHex(int64(targetBits)),
+			IntToHex(int64(activeNetParams.TargetBits)),
 			IntToHex(int64(nonce)),
 		},
 		[]byte{},
@@ -73,6 +71,13 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 	return nonce, hash[:]
 }
 
+//根据块的内容重新计算哈希，用来检查重建的块中的交易与块头是否一致
+func (pow *ProofOfWork) Hash() []byte {
+	hash := sha256.Sum256(pow.prepareData(pow.block.Nonce))
+
+	return hash[:]
+}
+
 func (pow *ProofOfWork) Validate() bool {
 	var hashInt big.Int
 
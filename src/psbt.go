@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+const psbtVersion = 1
+
+//部分签名交易（类似比特币的 PSBT）：一笔尚未完全签名的交易，以及它的每个输入所花费的输出
+//PrevOutputs 与 Tx.Vin 一一对应，签名只需要这些输出中的公钥哈希，
+//因此持有私钥的钱包可以在不连接网络、没有区块链数据库的机器上完成签名
+//已经完成的签名直接保存在 Tx.Vin 的 Signature 和 PubKey 中，不同的钱包可以分别为自己的输入签名
+type PartiallySignedTransaction struct {
+	Version     int
+	Tx          Transaction
+	PrevOutputs []TXOutput
+}
+
+//为一笔尚未签名的交易生成部分签名交易，从UTXO集中取出每个输入所花费的输出
+func NewPartiallySignedTransaction(tx *Transaction, UTXOSet *UTXOSet) *PartiallySignedTransaction {
+	var prevOutputs []TXOutput
+
+	for _, vin := range tx.Vin {
+		outs, ok := UTXOSet.FindOutputs(vin.Txid)
+		out, exists := outs.Outputs[vin.Vout]
+		if !ok || !exists {
+			log.Panicf("ERROR: Input %x:%d is missing or already spent", vin.Txid, vin.Vout)
+		}
+		prevOutputs = append(prevOutputs, out)
+	}
+
+	return &PartiallySignedTransaction{psbtVersion, *tx, prevOutputs}
+}
+
+//用钱包中的私钥为能够解锁的输入签名，返回这次签名的输入个数
+func (psbt *PartiallySignedTransaction) Sign(wallets *Wallets) int {
+	signed := 0
+
+	for inID, prevOut := range psbt.PrevOutputs {
+		wallet, ok := wallets.GetWalletByPubKeyHash(prevOut.PubKeyHash)
+		if !ok {
+			continue
+		}
+
+		psbt.Tx.Vin[inID].PubKey = wallet.PublicKey
+		psbt.Tx.SignInput(inID, wallet.Signer(), prevOut.PubKeyHash)
+		signed++
+	}
+
+	return signed
+}
+
+//判断是否所有输入都已经签名
+func (psbt *PartiallySignedTransaction) IsComplete() bool {
+	for _, vin := range psbt.Tx.Vin {
+		if len(vin.Signature) == 0 || len(vin.PubKey) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+//检查结构是否完整，并验证已经存在的签名
+func (psbt *PartiallySignedTransaction) Verify() error {
+	if psbt.Version != psbtVersion {
+		return fmt.Errorf("Unsupported PSBT version %d.", psbt.Version)
+	}
+	if len(psbt.PrevOutputs) != len(psbt.Tx.Vin) {
+		return errors.New("PSBT must have one previous output for every input.")
+	}
+
+	for inID, vin := range psbt.Tx.Vin {
+		if len(vin.Signature) == 0 {
+			continue
+		}
+
+		prevOut := psbt.PrevOutputs[inID]
+		if !vin.UsesKey(prevOut.PubKeyHash) || !psbt.Tx.VerifyInput(inID, prevOut.PubKeyHash) {
+			return fmt.Errorf("Input %d has an invalid signature.", inID)
+		}
+	}
+
+	return nil
+}
+
+//交易的手续费：所花费输出的总额减去交易输出的总额
+func (psbt *PartiallySignedTransaction) Fee() Amount {
+	fee := Amount(0)
+
+	for _, out := range psbt.PrevOutputs {
+		fee += out.Value
+	}
+	for _, out := range psbt.Tx.Vout {
+		fee -= out.Value
+	}
+
+	return fee
+}
+
+func (psbt PartiallySignedTransaction) Serialize() []byte {
+	var encoded bytes.Buffer
+
+	enc := gob.NewEncoder(&encoded)
+	err := enc.Encode(psbt)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return encoded.Bytes()
+}
+
+//解析部分签名交易，数据来自外部文件，因此返回错误而不是退出
+func DeserializePSBT(data []byte) (*PartiallySignedTransaction, error) {
+	var psbt PartiallySignedTransaction
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&psbt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = psbt.Verify()
+	if err != nil {
+		return nil, err
+	}
+
+	return &psbt, nil
+}
+
+//部分签名交易以十六进制文本的形式保存在文件中，方便在联网节点和离线钱包之间拷贝
+func LoadPSBT(path string) (*PartiallySignedTransaction, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	return DeserializePSBT(data)
+}
+
+//保存部分签名交易，path 为空时直接输出十六进制文本
+func (psbt PartiallySignedTransaction) SaveToFile(path string) {
+	content := hex.EncodeToString(psbt.Serialize())
+
+	if path == "" {
+		fmt.Println(content)
+		return
+	}
+
+	err := ioutil.WriteFile(path, []byte(content+"\n"), 0644)
+	if err != nil {
+		log.Panic(err)
+	}
+}
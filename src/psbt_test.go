@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+//花费创世块 coinbase 的未签名部分签名交易
+func newTestPSBT(t *testing.T) (*PartiallySignedTransaction, *Blockchain, *Wallet, CoinSelection) {
+	bc, wallet := newTestBlockchain(t)
+	generateBlocks(bc, activeNetParams.CoinbaseMaturity, string(NewWallet().GetAddress()))
+	UTXOSet := UTXOSet{bc}
+
+	recipients := []Recipient{{string(NewWallet().GetAddress()), Coin}}
+	tx, selection, err := NewUnsignedTransaction(string(wallet.GetAddress()), recipients, coinSelectors["largest"], &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewPartiallySignedTransaction(tx, &UTXOSet), bc, wallet, selection
+}
+
+func TestPSBTRoundTrip(t *testing.T) {
+	psbt, _, wallet, selection := newTestPSBT(t)
+	if psbt.IsComplete() {
+		t.Fatal("unsigned PSBT is complete")
+	}
+	if psbt.Fee() != selection.Fee {
+		t.Errorf("fee is %s, expected %s", psbt.Fee(), selection.Fee)
+	}
+
+	decoded, err := DeserializePSBT(psbt.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Serialize(), psbt.Serialize()) {
+		t.Error("unsigned PSBT changed after a round trip")
+	}
+
+	//在另一台机器上签名，通过文件传回
+	wallets := &Wallets{Wallets: map[string]*Wallet{string(wallet.GetAddress()): wallet}, WatchOnly: map[string]*WatchOnlyEntry{}}
+	if signed := decoded.Sign(wallets); signed != 1 {
+		t.Fatalf("signed %d inputs", signed)
+	}
+	path := filepath.Join(t.TempDir(), "tx.psbt")
+	decoded.SaveToFile(path)
+
+	loaded, err := LoadPSBT(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.IsComplete() || !bytes.Equal(loaded.Serialize(), decoded.Serialize()) {
+		t.Error("signed PSBT changed after a round trip")
+	}
+	if !bytes.Equal(loaded.Tx.ID, psbt.Tx.ID) {
+		t.Error("signing changed the transaction ID")
+	}
+}
+
+func TestPSBTVerify(t *testing.T) {
+	psbt, bc, wallet, _ := newTestPSBT(t)
+	resetMempool(t)
+	wallets := &Wallets{Wallets: map[string]*Wallet{string(wallet.GetAddress()): wallet}, WatchOnly: map[string]*WatchOnlyEntry{}}
+
+	//钱包中没有对应私钥时不签名
+	if signed := psbt.Sign(&Wallets{Wallets: map[string]*Wallet{}}); signed != 0 {
+		t.Errorf("signed %d inputs without the key", signed)
+	}
+	psbt.Sign(wallets)
+	if err := psbt.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if err := acceptToMempool(&psbt.Tx, bc); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := *psbt
+	tampered.Tx.Vout = append([]TXOutput{}, psbt.Tx.Vout...)
+	tampered.Tx.Vout[0].Value++
+	expectError(t, tampered.Verify(), "invalid signature")
+
+	wrongKey := *psbt
+	wrongKey.PrevOutputs = []TXOutput{*NewTXOutput(Coin, string(NewWallet().GetAddress()))}
+	expectError(t, wrongKey.Verify(), "invalid signature")
+
+	missing := *psbt
+	missing.PrevOutputs = nil
+	expectError(t, missing.Verify(), "one previous output for every input")
+
+	version := *psbt
+	version.Version = psbtVersion + 1
+	expectError(t, version.Verify(), "Unsupported PSBT version")
+	if _, err := DeserializePSBT(version.Serialize()); err == nil {
+		t.Error("PSBT of an unknown version is accepted")
+	}
+	if _, err := DeserializePSBT([]byte("not a psbt")); err == nil {
+		t.Error("garbage is accepted as a PSBT")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//交易的一个收款方
+type Recipient struct {
+	Address string
+	Amount  Amount
+}
+
+//JSON 文件中的一个收款方，金额可以写成数字或字符串，例如 1.5 或 "1.5"
+type recipientJSON struct {
+	Address string      `json:"address"`
+	Amount  json.Number `json:"amount"`
+}
+
+//从文件中读取收款方列表，文件扩展名为 .json 时按 JSON 解析，否则按 CSV 解析
+//JSON 格式：[{"address": "ADDRESS", "amount": "1.5"}, ...]
+//CSV 格式：每行一个 ADDRESS,AMOUNT，可以有一行 address,amount 的表头
+func LoadRecipients(path string) ([]Recipient, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var recipients []Recipient
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		recipients, err = readRecipientsJSON(file)
+	} else {
+		recipients, err = readRecipientsCSV(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("%s has no recipients.", path)
+	}
+
+	return recipients, nil
+}
+
+func readRecipientsJSON(r io.Reader) ([]Recipient, error) {
+	var entries []recipientJSON
+
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	err := decoder.Decode(&entries)
+	if err != nil {
+		return nil, err
+	}
+
+	var recipients []Recipient
+	for i, entry := range entries {
+		recipient, err := newRecipient(entry.Address, entry.Amount.String())
+		if err != nil {
+			return nil, fmt.Errorf("Entry %d: %s", i+1, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+func readRecipientsCSV(r io.Reader) ([]Recipient, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var recipients []Recipient
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(record[0], "address") {
+			continue
+		}
+
+		recipient, err := newRecipient(record[0], record[1])
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s", i+1, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+//检查地址和金额并生成一个收款方
+func newRecipient(address, amount string) (Recipient, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return Recipient{}, errors.New("Address is empty.")
+	}
+	if _, err := DecodeAddress(address); err != nil {
+		return Recipient{}, fmt.Errorf("Address %q is not valid: %s", address, err)
+	}
+
+	value, err := ParseAmount(strings.TrimSpace(amount))
+	if err != nil {
+		return Recipient{}, err
+	}
+	if value <= 0 {
+		return Recipient{}, fmt.Errorf("Amount for %s must be positive.", address)
+	}
+
+	return Recipient{address, value}, nil
+}
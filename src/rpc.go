@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/rpc"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//RPC 端口等于节点端口加上 rpcPortOffset，只监听本机
+const rpcPortOffset = 10000
+
+//使用 cookie 认证时 HTTP 基本认证的用户名
+const rpcCookieUser = "__cookie__"
+
+var errWalletLocked = errors.New("Wallet is locked, unlock it with walletpassphrase first.")
+
+//节点对本机命令行提供的 RPC 服务，客户端必须提供 rpc.password 或者节点写入数据目录的 cookie
+//钱包在节点中默认是锁定的，walletpassphrase 在一段时间内解锁它（明文钱包不需要密码），到期或 walletlock 后重新锁定
+type NodeRPC struct {
+	nodeID    string
+	bc        *Blockchain
+	mu        sync.Mutex
+	wallets   *Wallets
+	lockTimer *time.Timer
+}
+
+type WalletPassphraseArgs struct {
+	Passphrase []byte
+	Timeout    int
+}
+
+type WalletLockArgs struct{}
+
+type SendArgs struct {
+	From       string
+	To         string
+	Amount     Amount
+	CoinSelect string
+}
+
+type SendReply struct {
+	TxID []byte
+	Fee  Amount
+}
+
+//立即挖出 Blocks 个区块，奖励发给 Address
+type GenerateArgs struct {
+	Blocks  int
+	Address string
+}
+
+//查询钱包时只传递公钥哈希，节点不需要解锁钱包
+type WalletQueryArgs struct {
+	PubKeyHashes map[string]string
+}
+
+type ListBannedArgs struct{}
+
+//禁止 Address 连接 Duration 秒，Remove 为 true 时解除禁止
+type SetBanArgs struct {
+	Address  string
+	Remove   bool
+	Duration int
+}
+
+//节点 RPC 服务的地址
+func rpcAddress(nodeID string) string {
+	if activeConfig.RPCListen != "" {
+		return activeConfig.RPCListen
+	}
+
+	port, err := strconv.Atoi(nodeID)
+	if err != nil {
+		log.Panic("ERROR: NODE_ID must be a port number")
+	}
+
+	return fmt.Sprintf("localhost:%d", port+rpcPortOffset)
+}
+
+//启动 RPC 服务
+func StartRPCServer(nodeID string, bc *Blockchain) {
+	nodeRPC := &NodeRPC{nodeID: nodeID, bc: bc}
+
+	server := rpc.NewServer()
+	err := server.RegisterName("Node", nodeRPC)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	ln, err := net.Listen(protocol, rpcAddress(nodeID))
+	if err != nil {
+		log.Panic(err)
+	}
+
+	go http.Serve(ln, rpcAuthHandler{server, newRPCCredentials(nodeID)})
+}
+
+//没有设置 rpc.password 时，每次启动节点生成一个随机的 cookie，写入只有当前用户能读取的文件
+func newRPCCredentials(nodeID string) string {
+	if activeConfig.RPCPassword != "" {
+		return activeConfig.RPCPassword
+	}
+
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		log.Panic(err)
+	}
+	cookie := hex.EncodeToString(token)
+
+	err = writeFileAtomic(rpcCookiePath(nodeID), []byte(cookie), 0600)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return cookie
+}
+
+//客户端的认证信息，节点没有运行时 cookie 文件可能不存在
+func readRPCCredentials(nodeID string) (string, error) {
+	if activeConfig.RPCPassword != "" {
+		return activeConfig.RPCPassword, nil
+	}
+
+	content, err := ioutil.ReadFile(rpcCookiePath(nodeID))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+//只把认证通过的请求交给 RPC 服务
+type rpcAuthHandler struct {
+	server      *rpc.Server
+	credentials string
+}
+
+func (h rpcAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, password, ok := r.BasicAuth()
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(h.credentials)) != 1 {
+		logWarn("Rejected unauthenticated RPC request from %s", r.RemoteAddr)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.server.ServeHTTP(w, r)
+}
+
+//解锁钱包，Timeout 秒后自动锁定，明文钱包的密码为空
+func (n *NodeRPC) WalletPassphrase(args WalletPassphraseArgs, reply *bool) error {
+	if args.Timeout <= 0 {
+		return errors.New("Timeout must be positive.")
+	}
+
+	wallets, err := NewWalletsWithPassphrase(n.nodeID, args.Passphrase)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.lockTimer != nil {
+		n.lockTimer.Stop()
+	}
+	timeout := time.Duration(args.Timeout) * time.Second
+	n.wallets = wallets
+	n.lockTimer = time.AfterFunc(timeout, n.lock)
+	*reply = true
+
+	return nil
+}
+
+//立即锁定钱包，丢弃内存中解密后的私钥
+func (n *NodeRPC) WalletLock(args WalletLockArgs, reply *bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.wallets == nil {
+		return errors.New("Wallet is not unlocked.")
+	}
+
+	if n.lockTimer != nil {
+		n.lockTimer.Stop()
+		n.lockTimer = nil
+	}
+	n.wallets = nil
+	*reply = true
+
+	return nil
+}
+
+func (n *NodeRPC) lock() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.wallets = nil
+}
+
+//使用节点中已解锁的钱包签名并广播一笔交易
+func (n *NodeRPC) Send(args SendArgs, reply *SendReply) error {
+	if !ValidateAddress(args.From) || !ValidateAddress(args.To) {
+		return errors.New("Address is not valid.")
+	}
+	if args.Amount <= 0 || !MoneyRange(args.Amount) {
+		return errors.New("Amount is out of range.")
+	}
+	selector, ok := coinSelectors[args.CoinSelect]
+	if !ok {
+		return fmt.Errorf("Unknown coin selection strategy %q.", args.CoinSelect)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.wallets == nil {
+		return errWalletLocked
+	}
+	wallet, ok := n.wallets.Wallets[normalizeAddress(args.From)]
+	if !ok && n.wallets.IsWatchOnly(args.From) {
+		return fmt.Errorf("Address %s is watch-only.", args.From)
+	}
+	if !ok {
+		return fmt.Errorf("Address %s is not in the wallet.", args.From)
+	}
+
+	//选币和加入内存池之间不能有新的区块改变 UTXO 集
+	nodeMu.Lock()
+	UTXOSet := UTXOSet{n.bc}
+	tx, fee, err := NewUTXOTransaction(wallet, args.To, args.Amount, selector, &UTXOSet)
+	if err == nil {
+		err = acceptToMempool(tx, n.bc)
+	}
+	nodeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	relayInventory("tx", tx.ID, nil)
+	logInfo("Sent transaction %s", hex.EncodeToString(tx.ID))
+
+	reply.TxID = tx.ID
+	reply.Fee = fee
+
+	return nil
+}
+
+//立即挖出区块，打包内存池中的交易并通知其他节点，返回新区块的哈希
+func (n *NodeRPC) Generate(args GenerateArgs, reply *[][]byte) error {
+	if args.Blocks <= 0 {
+		return errors.New("Number of blocks must be positive.")
+	}
+	if _, err := DecodeAddress(args.Address); err != nil {
+		return err
+	}
+
+	nodeMu.Lock()
+	blocks := generateBlocks(n.bc, args.Blocks, args.Address)
+	nodeMu.Unlock()
+
+	for _, block := range blocks {
+		broadcastBlock(block)
+		*reply = append(*reply, block.Hash)
+	}
+
+	return nil
+}
+
+//节点运行时数据库被节点占用，命令行通过它查询钱包的未花费输出，包括内存池中的交易
+func (n *NodeRPC) ListUnspent(args WalletQueryArgs, reply *[]WalletUnspent) error {
+	nodeMu.Lock()
+	defer nodeMu.Unlock()
+
+	UTXOSet := UTXOSet{n.bc}
+	*reply = FindWalletUnspent(args.PubKeyHashes, &UTXOSet, mempoolTransactions())
+
+	return nil
+}
+
+//查询钱包的交易记录，包括内存池中的交易
+func (n *NodeRPC) ListTransactions(args WalletQueryArgs, reply *[]WalletTransaction) error {
+	nodeMu.Lock()
+	defer nodeMu.Unlock()
+
+	*reply = ListWalletTransactions(args.PubKeyHashes, n.bc, mempoolTransactions())
+
+	return nil
+}
+
+//列出被禁止的 IP
+func (n *NodeRPC) ListBanned(args ListBannedArgs, reply *[]BanEntry) error {
+	*reply = banManager.List()
+
+	return nil
+}
+
+//手动禁止或解除禁止一个 IP，禁止时断开它的所有连接
+func (n *NodeRPC) SetBan(args SetBanArgs, reply *bool) error {
+	if !validBanAddress(args.Address) {
+		return fmt.Errorf("%q is not an IP address.", args.Address)
+	}
+
+	if args.Remove {
+		if !banManager.Unban(args.Address) {
+			return fmt.Errorf("%s is not banned.", args.Address)
+		}
+		*reply = true
+		return nil
+	}
+
+	duration := activeConfig.BanTime
+	if args.Duration > 0 {
+		duration = time.Duration(args.Duration) * time.Second
+	}
+	banManager.Ban(args.Address, duration, "manually banned")
+	peerManager.DisconnectAddress(args.Address)
+	*reply = true
+
+	return nil
+}
+
+func mempoolTransactions() []Transaction {
+	var txs []Transaction
+	for _, tx := range mempool {
+		txs = append(txs, tx)
+	}
+
+	return txs
+}
+
+//连接本机节点的 RPC 服务
+func dialRPC(nodeID string) *rpc.Client {
+	client, err := dialAuthenticatedRPC(nodeID)
+	if err != nil {
+		log.Panic("ERROR: Node is not running: ", err)
+	}
+
+	return client
+}
+
+//连接本机节点的 RPC 服务，节点没有运行时返回 nil
+func dialRunningNode(nodeID string) *rpc.Client {
+	client, err := dialAuthenticatedRPC(nodeID)
+	if err != nil {
+		return nil
+	}
+
+	return client
+}
+
+//与 rpc.DialHTTP 相同，但是在 CONNECT 请求中带上认证信息
+func dialAuthenticatedRPC(nodeID string) (*rpc.Client, error) {
+	credentials, err := readRPCCredentials(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	address := rpcAddress(nodeID)
+	conn, err := net.DialTimeout(protocol, address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("CONNECT", "http://"+address+rpc.DefaultRPCPath, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	req.SetBasicAuth(rpcCookieUser, credentials)
+	err = req.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("RPC server refused the connection: %s", resp.Status)
+	}
+
+	return rpc.NewClient(conn), nil
+}
+
+//节点正在运行时通过 RPC 查询，否则直接读取数据库（此时没有内存池）
+func queryWallet(method string, wallets *Wallets, nodeID string, reply interface{}) bool {
+	client := dialRunningNode(nodeID)
+	if client == nil {
+		return false
+	}
+	defer client.Close()
+
+	err := client.Call("Node."+method, WalletQueryArgs{wallets.PubKeyHashes()}, reply)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return true
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net"
+	"net/rpc"
+	"os"
+	"testing"
+)
+
+//在随机的本机端口上启动 RPC 服务，使用临时目录中的 cookie
+func startTestRPCServer(t *testing.T) string {
+	ln, err := net.Listen(protocol, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	config := activeConfig
+	activeConfig = defaultConfig()
+	activeConfig.DataDir = t.TempDir()
+	activeConfig.RPCListen = address
+	t.Cleanup(func() { activeConfig = config })
+
+	StartRPCServer("rpctest", nil)
+
+	return address
+}
+
+func TestRPCRequiresCookie(t *testing.T) {
+	address := startTestRPCServer(t)
+
+	info, err := os.Stat(rpcCookiePath("rpctest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("cookie file mode is %v", info.Mode().Perm())
+	}
+
+	client, err := dialAuthenticatedRPC("rpctest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bans []BanEntry
+	err = client.Call("Node.ListBanned", ListBannedArgs{}, &bans)
+	client.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rpc.DialHTTP(protocol, address); err == nil {
+		t.Error("connected without credentials")
+	}
+
+	activeConfig.RPCPassword = "wrong"
+	if _, err := dialAuthenticatedRPC("rpctest"); err == nil {
+		t.Error("connected with a wrong password")
+	}
+}
+
+func TestRPCWalletIsLockedAtStart(t *testing.T) {
+	n := &NodeRPC{nodeID: "rpctest"}
+	from := string(NewWallet().GetAddress())
+	to := string(NewWallet().GetAddress())
+
+	var reply SendReply
+	err := n.Send(SendArgs{from, to, Coin, "largest"}, &reply)
+	if err != errWalletLocked {
+		t.Errorf("expected the wallet to be locked, got %v", err)
+	}
+}
+
+func TestRPCListenOffLoopbackNeedsPassword(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.NodeID = "3000"
+	cfg.RPCListen = "0.0.0.0:13000"
+	if err := cfg.finish(); err == nil {
+		t.Error("non-loopback RPC address accepted without a password")
+	}
+
+	cfg.RPCPassword = "secret"
+	if err := cfg.finish(); err != nil {
+		t.Error(err)
+	}
+
+	cfg = defaultConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.NodeID = "3000"
+	cfg.RPCListen = "127.0.0.1:13000"
+	if err := cfg.finish(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRPCSendWithoutFundsReturnsError(t *testing.T) {
+	bc, _ := newTestBlockchain(t)
+	wallet := NewWallet()
+	from := string(wallet.GetAddress())
+	wallets := &Wallets{Wallets: map[string]*Wallet{from: wallet}, WatchOnly: map[string]*WatchOnlyEntry{}}
+	n := &NodeRPC{nodeID: "rpctest", bc: bc, wallets: wallets}
+
+	var reply SendReply
+	err := n.Send(SendArgs{from, string(NewWallet().GetAddress()), Coin, "largest"}, &reply)
+	if err == nil {
+		t.Fatal("sent without funds")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"log"
+	"math/big"
+)
+
+//BIP340 Schnorr 签名：公钥是Y坐标为偶数的点的X坐标（32 字节），签名是 R.x || s（64 字节）
+const schnorrPubKeyLen = 32
+
+//BIP340 中带标签的哈希 SHA256(SHA256(tag) || SHA256(tag) || msg)，不同用途的哈希不会相互冲突
+func taggedHash(tag string, msg ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+
+	hasher := sha256.New()
+	hasher.Write(tagHash[:])
+	hasher.Write(tagHash[:])
+	for _, m := range msg {
+		hasher.Write(m)
+	}
+
+	return hasher.Sum(nil)
+}
+
+//使用随机的辅助数据签名
+func schnorrSign(d *big.Int, msg []byte) []byte {
+	aux := make([]byte, coordinateLen)
+	_, err := rand.Read(aux)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return schnorrSignWithAux(d, msg, aux)
+}
+
+//BIP340 的签名算法，aux 是 32 字节的辅助随机数据
+func schnorrSignWithAux(d *big.Int, msg, aux []byte) []byte {
+	curve := secp256k1
+	N := curve.params.N
+
+	px, py := curve.ScalarBaseMult(d.Bytes())
+	d = new(big.Int).Set(d)
+	if py.Bit(0) == 1 {
+		d.Sub(N, d)
+	}
+	pubKey := px.FillBytes(make([]byte, coordinateLen))
+
+	t := d.FillBytes(make([]byte, coordinateLen))
+	auxHash := taggedHash("BIP0340/aux", aux)
+	for i := range t {
+		t[i] ^= auxHash[i]
+	}
+
+	k := new(big.Int).SetBytes(taggedHash("BIP0340/nonce", t, pubKey, msg))
+	k.Mod(k, N)
+	if k.Sign() == 0 {
+		log.Panic("ERROR: Schnorr nonce is zero")
+	}
+
+	rx, ry := curve.ScalarBaseMult(k.Bytes())
+	if ry.Bit(0) == 1 {
+		k.Sub(N, k)
+	}
+	r := rx.FillBytes(make([]byte, coordinateLen))
+
+	e := schnorrChallenge(r, pubKey, msg)
+	s := e.Mul(e, d)
+	s.Add(s, k)
+	s.Mod(s, N)
+
+	return append(r, s.FillBytes(make([]byte, coordinateLen))...)
+}
+
+//e = int(hash(R.x || P.x || msg)) mod n
+func schnorrChallenge(r, pubKey, msg []byte) *big.Int {
+	e := new(big.Int).SetBytes(taggedHash("BIP0340/challenge", r, pubKey, msg))
+
+	return e.Mod(e, secp256k1.params.N)
+}
+
+//验证单个 Schnorr 签名
+func schnorrVerify(pubKey, msg, signature []byte) bool {
+	return schnorrBatchVerify([]schnorrBatchItem{{pubKey, msg, signature}})
+}
+
+//批量验证中的一个签名
+type schnorrBatchItem struct {
+	PubKey    []byte
+	Msg       []byte
+	Signature []byte
+}
+
+//一组等待一起验证的 Schnorr 签名
+type SchnorrBatch struct {
+	items []schnorrBatchItem
+}
+
+func (b *SchnorrBatch) Add(pubKey, msg, signature []byte) {
+	b.items = append(b.items, schnorrBatchItem{pubKey, msg, signature})
+}
+
+func (b *SchnorrBatch) Len() int {
+	return len(b.items)
+}
+
+//所有签名都有效时返回 true
+func (b *SchnorrBatch) Verify() bool {
+	return schnorrBatchVerify(b.items)
+}
+
+//BIP340 的批量验证：选取随机系数 a_1 = 1, a_2...a_u，检查
+//(s_1 + a_2*s_2 + ... + a_u*s_u)*G = R_1 + a_2*R_2 + ... + e_1*P_1 + a_2*e_2*P_2 + ...
+//等式两边移到同一边后只需要一次多标量乘法，签名越多节省越多
+//随机系数使得无效的签名无法相互抵消，只有一个签名时与单独验证完全相同
+func schnorrBatchVerify(items []schnorrBatchItem) bool {
+	curve := secp256k1
+	N := curve.params.N
+	P := curve.params.P
+
+	var points []jacobianPoint
+	var scalars []*big.Int
+	sSum := new(big.Int)
+
+	for i, item := range items {
+		if len(item.PubKey) != schnorrPubKeyLen || len(item.Signature) != signatureLen {
+			return false
+		}
+
+		px := new(big.Int).SetBytes(item.PubKey)
+		py, err := curve.liftX(px)
+		if err != nil {
+			return false
+		}
+
+		rBytes := item.Signature[:coordinateLen]
+		r := new(big.Int).SetBytes(rBytes)
+		s := new(big.Int).SetBytes(item.Signature[coordinateLen:])
+		if r.Cmp(P) >= 0 || s.Cmp(N) >= 0 {
+			return false
+		}
+		ry, err := curve.liftX(r)
+		if err != nil {
+			return false
+		}
+
+		a := big.NewInt(1)
+		if i > 0 {
+			a = randScalar(N)
+		}
+		e := schnorrChallenge(rBytes, item.PubKey, item.Msg)
+
+		//右边的 a*R + a*e*P 取负后加到左边，最后检查结果是否是无穷远点
+		points = append(points, curve.fromAffine(r, new(big.Int).Sub(P, ry)))
+		scalars = append(scalars, a)
+		points = append(points, curve.fromAffine(px, new(big.Int).Sub(P, py)))
+		scalars = append(scalars, new(big.Int).Mod(e.Mul(e, a), N))
+
+		sSum.Add(sSum, s.Mul(s, a))
+		sSum.Mod(sSum, N)
+	}
+
+	points = append(points, curve.fromAffine(curve.params.Gx, curve.params.Gy))
+	scalars = append(scalars, sSum)
+
+	return curve.multiScalarMult(points, scalars).Z.Sign() == 0
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+//BIP340 的官方测试向量，私钥为空的向量只用于验证
+var bip340Vectors = []struct {
+	secretKey, publicKey, auxRand, message, signature string
+	valid                                             bool
+}{
+	{"0000000000000000000000000000000000000000000000000000000000000003", "F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9", "0000000000000000000000000000000000000000000000000000000000000000", "0000000000000000000000000000000000000000000000000000000000000000", "E907831F80848D1069A5371B402410364BDF1C5F8307B0084C55F1CE2DCA821525F66A4A85EA8B71E482A74F382D2CE5EBEEE8FDB2172F477DF4900D310536C0", true},
+	{"B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "0000000000000000000000000000000000000000000000000000000000000001", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6896BD60EEAE296DB48A229FF71DFE071BDE413E6D43F917DC8DCF8C78DE33418906D11AC976ABCCB20B091292BFF4EA897EFCB639EA871CFA95F6DE339E4B0A", true},
+	{"C90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B14E5C9", "DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EB8", "C87AA53824B4D7AE2EB035A2B5BBBCCC080E76CDC6D1692C4B0B62D798E6D906", "7E2D58D8B3BCDF1ABADEC7829054F90DDA9805AAB56C77333024B9D0A508B75C", "5831AAEED7B44BB74E5EAB94BA9D4294C49BCF2A60728D8B4C200F50DD313C1BAB745879A5AD954A72C45A91C3A51D3C7ADEA98D82F8481E0E1E03674A6F3FB7", true},
+	//消息不能按 p 或 n 取模
+	{"0B432B2677937381AEF05BB02A66ECD012773062CF3FA2549E44F58ED2401710", "25D1DFF95105F5253C4022F628A996AD3A0D95FBF21D468A1B33F8C160D8F517", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", "7EB0509757E246F19449885651611CB965ECC1A187DD51B64FDA1EDC9637D5EC97582B9CB13DB3933705B32BA982AF5AF25FD78881EBB32771FC5922EFC66EA3", true},
+	{"", "D69C3509BB99E412E68B0FE8544E72837DFA30746D8BE2AA65975F29D22DC7B9", "", "4DF3C3F68FCC83B27E9D42C90431A72499F17875C81A599B566C9889B9696703", "00000000000000000000003B78CE563F89A0ED9414F5AA28AD0D96D6795F9C6376AFB1548AF603B3EB45C9F8207DEE1060CB71C04E80F593060B07D28308D7F4", true},
+	//公钥不在曲线上
+	{"", "EEFDEA4CDB677750A420FEE807EACF21EB9898AE79B9768766E4FAA04A2D4A34", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	//R 的 Y 坐标是奇数
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "FFF97BD5755EEEA420453A14355235D382F6472F8568A18B2F057A14602975563CC27944640AC607CD107AE10923D9EF7A73C643E166BE5EBEAFA34B1AC553E2", false},
+	//消息被取反
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "1FA62E331EDBC21C394792D2AB1100A7B432B013DF3F6FF4F99FCB33E0E1515F28890B3EDB6E7189B630448B515CE4F8622A954CFE545735AAEA5134FCCDB2BD", false},
+	//s 被取反
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E177769961764B3AA9B2FFCB6EF947B6887A226E8D7C93E00C5ED0C1834FF0D0C2E6DA6", false},
+	//sG - eP 是无穷远点
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "0000000000000000000000000000000000000000000000000000000000000000123DDA8328AF9C23A94C1FEECFD123BA4FB73476F0D594DCB65C6425BD186051", false},
+	//sG - eP 是无穷远点
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "00000000000000000000000000000000000000000000000000000000000000017615FBAF5AE28864013C099742DEADB4DBA87F11AC6754F93780D5A1837CF197", false},
+	//R.x 不是曲线上点的 X 坐标
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "4A298DACAE57395A15D0795DDBFD1DCB564DA82B0F269BC70A74F8220429BA1D69E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	//R.x 等于 p
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F69E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	//s 等于 n
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E177769FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", false},
+	//公钥超出了域的大小
+	{"", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC30", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+}
+
+//私钥 d 对应的 32 字节 X 坐标公钥
+func schnorrTestPublicKey(d *big.Int) []byte {
+	x, _ := secp256k1.ScalarBaseMult(d.Bytes())
+
+	return x.FillBytes(make([]byte, coordinateLen))
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestBIP340Vectors(t *testing.T) {
+	for i, v := range bip340Vectors {
+		pubKey := decodeHex(t, v.publicKey)
+		msg := decodeHex(t, v.message)
+		signature := decodeHex(t, v.signature)
+
+		if v.secretKey != "" {
+			d := new(big.Int).SetBytes(decodeHex(t, v.secretKey))
+			if !bytes.Equal(schnorrTestPublicKey(d), pubKey) {
+				t.Errorf("vector %d: public key %X", i, schnorrTestPublicKey(d))
+			}
+			sig := schnorrSignWithAux(d, msg, decodeHex(t, v.auxRand))
+			if !bytes.Equal(sig, signature) {
+				t.Errorf("vector %d: signature %X", i, sig)
+			}
+		}
+
+		if schnorrVerify(pubKey, msg, signature) != v.valid {
+			t.Errorf("vector %d: verification result is not %v", i, v.valid)
+		}
+	}
+}
+
+func TestSchnorrBatchRejectsOneBadSignature(t *testing.T) {
+	var batch SchnorrBatch
+	for i := 0; i < 8; i++ {
+		d := randScalar(secp256k1.params.N)
+		msg := sha256.Sum256([]byte{byte(i)})
+		batch.Add(schnorrTestPublicKey(d), msg[:], schnorrSign(d, msg[:]))
+	}
+	if !batch.Verify() {
+		t.Fatal("valid batch is rejected")
+	}
+
+	//把一个签名换成另一条消息的签名
+	bad := batch.items[5]
+	other := sha256.Sum256([]byte("other"))
+	batch.items[5].Msg = other[:]
+	if batch.Verify() {
+		t.Error("batch with a wrong message is accepted")
+	}
+	batch.items[5] = bad
+
+	batch.items[2].Signature = append([]byte{}, batch.items[2].Signature...)
+	batch.items[2].Signature[signatureLen-1] ^= 1
+	if batch.Verify() {
+		t.Error("batch with a modified signature is accepted")
+	}
+}
+
+func TestBIP340VectorsInBatch(t *testing.T) {
+	var batch SchnorrBatch
+	for _, v := range bip340Vectors {
+		if v.valid {
+			batch.Add(decodeHex(t, v.publicKey), decodeHex(t, v.message), decodeHex(t, v.signature))
+		}
+	}
+	if !batch.Verify() {
+		t.Fatal("valid vectors are rejected as a batch")
+	}
+
+	for i, v := range bip340Vectors {
+		if v.valid {
+			continue
+		}
+		invalid := batch
+		invalid.items = append(append([]schnorrBatchItem{}, batch.items...), schnorrBatchItem{decodeHex(t, v.publicKey), decodeHex(t, v.message), decodeHex(t, v.signature)})
+		if invalid.Verify() {
+			t.Errorf("vector %d is accepted in a batch", i)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"log"
+	"math/big"
+)
+
+//比特币使用的 secp256k1 曲线：y^2 = x^3 + 7，标准库没有提供，这里用 math/big 实现
+//曲线的 a = 0，elliptic.CurveParams 自带的运算假设 a = -3，所以不能直接使用
+type secp256k1Curve struct {
+	params *elliptic.CurveParams
+}
+
+var secp256k1 = newSecp256k1()
+
+func newSecp256k1() *secp256k1Curve {
+	params := &elliptic.CurveParams{Name: "secp256k1", BitSize: 256}
+	params.P, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F", 16)
+	params.N, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+	params.B = big.NewInt(7)
+	params.Gx, _ = new(big.Int).SetString("79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798", 16)
+	params.Gy, _ = new(big.Int).SetString("483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8", 16)
+
+	return &secp256k1Curve{params}
+}
+
+func (c *secp256k1Curve) Params() *elliptic.CurveParams {
+	return c.params
+}
+
+func (c *secp256k1Curve) IsOnCurve(x, y *big.Int) bool {
+	P := c.params.P
+	if x.Sign() < 0 || x.Cmp(P) >= 0 || y.Sign() < 0 || y.Cmp(P) >= 0 {
+		return false
+	}
+
+	return new(big.Int).Exp(y, big.NewInt(2), P).Cmp(c.curveY2(x)) == 0
+}
+
+//x^3 + 7 mod p
+func (c *secp256k1Curve) curveY2(x *big.Int) *big.Int {
+	y2 := new(big.Int).Exp(x, big.NewInt(3), c.params.P)
+	y2.Add(y2, c.params.B)
+
+	return y2.Mod(y2, c.params.P)
+}
+
+//由X坐标求出Y坐标为偶数的点，p ≡ 3 (mod 4)，所以平方根是 c^((p+1)/4)
+func (c *secp256k1Curve) liftX(x *big.Int) (*big.Int, error) {
+	P := c.params.P
+	if x.Cmp(P) >= 0 {
+		return nil, errors.New("X coordinate is not smaller than the field size.")
+	}
+
+	y2 := c.curveY2(x)
+	exp := new(big.Int).Add(P, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	y := new(big.Int).Exp(y2, exp, P)
+	if new(big.Int).Exp(y, big.NewInt(2), P).Cmp(y2) != 0 {
+		return nil, errors.New("X coordinate is not on the curve.")
+	}
+	if y.Bit(0) == 1 {
+		y.Sub(P, y)
+	}
+
+	return y, nil
+}
+
+func (c *secp256k1Curve) Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	return c.toAffine(c.addJacobian(c.fromAffine(x1, y1), c.fromAffine(x2, y2)))
+}
+
+func (c *secp256k1Curve) Double(x1, y1 *big.Int) (*big.Int, *big.Int) {
+	return c.toAffine(c.doubleJacobian(c.fromAffine(x1, y1)))
+}
+
+func (c *secp256k1Curve) ScalarMult(x1, y1 *big.Int, k []byte) (*big.Int, *big.Int) {
+	return c.toAffine(c.multiScalarMult([]jacobianPoint{c.fromAffine(x1, y1)}, []*big.Int{new(big.Int).SetBytes(k)}))
+}
+
+func (c *secp256k1Curve) ScalarBaseMult(k []byte) (*big.Int, *big.Int) {
+	return c.ScalarMult(c.params.Gx, c.params.Gy, k)
+}
+
+//雅可比坐标 (X, Y, Z) 表示仿射坐标 (X/Z^2, Y/Z^3)，Z = 0 表示无穷远点
+//中间过程不需要求模逆，只在最后转换回仿射坐标时求一次
+type jacobianPoint struct {
+	X, Y, Z *big.Int
+}
+
+//仿射坐标 (0, 0) 按照 elliptic 包的约定表示无穷远点
+func (c *secp256k1Curve) fromAffine(x, y *big.Int) jacobianPoint {
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+	}
+
+	return jacobianPoint{new(big.Int).Set(x), new(big.Int).Set(y), big.NewInt(1)}
+}
+
+func (c *secp256k1Curve) toAffine(p jacobianPoint) (*big.Int, *big.Int) {
+	if p.Z.Sign() == 0 {
+		return new(big.Int), new(big.Int)
+	}
+
+	P := c.params.P
+	zInv := new(big.Int).ModInverse(p.Z, P)
+	zInv2 := new(big.Int).Mul(zInv, zInv)
+	x := new(big.Int).Mul(p.X, zInv2)
+	x.Mod(x, P)
+	y := new(big.Int).Mul(p.Y, zInv2.Mul(zInv2, zInv))
+	y.Mod(y, P)
+
+	return x, y
+}
+
+//a = 0 时的倍点公式 dbl-2009-l
+func (c *secp256k1Curve) doubleJacobian(p jacobianPoint) jacobianPoint {
+	P := c.params.P
+	if p.Z.Sign() == 0 || p.Y.Sign() == 0 {
+		return jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+	}
+
+	A := new(big.Int).Mul(p.X, p.X)
+	A.Mod(A, P)
+	B := new(big.Int).Mul(p.Y, p.Y)
+	B.Mod(B, P)
+	C := new(big.Int).Mul(B, B)
+	C.Mod(C, P)
+
+	D := new(big.Int).Add(p.X, B)
+	D.Mul(D, D)
+	D.Sub(D, A)
+	D.Sub(D, C)
+	D.Lsh(D, 1)
+	D.Mod(D, P)
+
+	E := new(big.Int).Mul(A, big.NewInt(3))
+	F := new(big.Int).Mul(E, E)
+
+	x3 := new(big.Int).Sub(F, new(big.Int).Lsh(D, 1))
+	x3.Mod(x3, P)
+
+	y3 := new(big.Int).Sub(D, x3)
+	y3.Mul(y3, E)
+	y3.Sub(y3, C.Lsh(C, 3))
+	y3.Mod(y3, P)
+
+	z3 := new(big.Int).Mul(p.Y, p.Z)
+	z3.Lsh(z3, 1)
+	z3.Mod(z3, P)
+
+	return jacobianPoint{x3, y3, z3}
+}
+
+//通用的加法公式 add-2007-bl，两个点相同时改用倍点公式
+func (c *secp256k1Curve) addJacobian(p, q jacobianPoint) jacobianPoint {
+	P := c.params.P
+	if p.Z.Sign() == 0 {
+		return q
+	}
+	if q.Z.Sign() == 0 {
+		return p
+	}
+
+	z1z1 := new(big.Int).Mul(p.Z, p.Z)
+	z1z1.Mod(z1z1, P)
+	z2z2 := new(big.Int).Mul(q.Z, q.Z)
+	z2z2.Mod(z2z2, P)
+
+	u1 := new(big.Int).Mul(p.X, z2z2)
+	u1.Mod(u1, P)
+	u2 := new(big.Int).Mul(q.X, z1z1)
+	u2.Mod(u2, P)
+	s1 := new(big.Int).Mul(p.Y, q.Z)
+	s1.Mul(s1, z2z2)
+	s1.Mod(s1, P)
+	s2 := new(big.Int).Mul(q.Y, p.Z)
+	s2.Mul(s2, z1z1)
+	s2.Mod(s2, P)
+
+	h := new(big.Int).Sub(u2, u1)
+	h.Mod(h, P)
+	r := new(big.Int).Sub(s2, s1)
+	r.Mod(r, P)
+	if h.Sign() == 0 {
+		if r.Sign() == 0 {
+			return c.doubleJacobian(p)
+		}
+		return jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+	}
+
+	hh := new(big.Int).Mul(h, h)
+	hh.Mod(hh, P)
+	hhh := new(big.Int).Mul(h, hh)
+	hhh.Mod(hhh, P)
+	v := new(big.Int).Mul(u1, hh)
+	v.Mod(v, P)
+
+	x3 := new(big.Int).Mul(r, r)
+	x3.Sub(x3, hhh)
+	x3.Sub(x3, new(big.Int).Lsh(v, 1))
+	x3.Mod(x3, P)
+
+	y3 := new(big.Int).Sub(v, x3)
+	y3.Mul(y3, r)
+	y3.Sub(y3, s1.Mul(s1, hhh))
+	y3.Mod(y3, P)
+
+	z3 := new(big.Int).Mul(p.Z, q.Z)
+	z3.Mul(z3, h)
+	z3.Mod(z3, P)
+
+	return jacobianPoint{x3, y3, z3}
+}
+
+//计算 k1*P1 + k2*P2 + ...，所有的点共用同一串倍点运算（Straus 算法）
+//批量验证 Schnorr 签名时用它把多个标量乘法合并成一次
+func (c *secp256k1Curve) multiScalarMult(points []jacobianPoint, scalars []*big.Int) jacobianPoint {
+	result := jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+
+	bits := 0
+	for _, k := range scalars {
+		if k.BitLen() > bits {
+			bits = k.BitLen()
+		}
+	}
+
+	for i := bits - 1; i >= 0; i-- {
+		result = c.doubleJacobian(result)
+		for j, k := range scalars {
+			if k.Bit(i) == 1 {
+				result = c.addJacobian(result, points[j])
+			}
+		}
+	}
+
+	return result
+}
+
+//生成 [1, n-1] 之间的随机数
+func randScalar(N *big.Int) *big.Int {
+	max := new(big.Int).Sub(N, big.NewInt(1))
+	k, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return k.Add(k, big.NewInt(1))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+//k*G 的已知结果
+var secp256k1ScalarVectors = []struct {
+	k, x, y string
+}{
+	{"1", "79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798", "483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8"},
+	{"2", "C6047F9441ED7D6D3045406E95C07CD85C778E4B8CEF3CA7ABAC09B95C709EE5", "1AE168FEA63DC339A3C58419466CEAEEF7F632653266D0E1236431A950CFE52A"},
+	{"3", "F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9", "388F7B0F632DE8140FE337E62A37F3566500A99934C2231B6CB9FD7584B8E672"},
+	{"4", "E493DBF1C10D80F3581E4904930B1404CC6C13900EE0758474FA94ABE8C4CD13", "51ED993EA0D455B75642E2098EA51448D967AE33BFBDFE40CFE97BDC47739922"},
+	{"5", "2F8BDE4D1A07209355B4A7250A5C5128E88B84BDDC619AB7CBA8D569B240EFE4", "D8AC222636E5E3D6D4DBA9DDA6C9C426F788271BAB0D6840DCA87D3AA6AC62D6"},
+	{"A", "A0434D9E47F3C86235477C7B1AE6AE5D3442D49B1943C2B752A68E2A47E247C7", "893ABA425419BC27A3B6C7E693A24C696F794C2ED877A1593CBEE53B037368D7"},
+	{"18EBBB95EED0E13", "A90CC3D3F3E146DAADFC74CA1372207CB4B725AE708CEF713A98EDD73D99EF29", "5A79D6B289610C68BC3B47F3D72F9788A26A06868B4D8E433E1E2AD76FB7DC76"},
+	{"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364140", "79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798", "B7C52588D95C3B9AA25B0403F1EEF75702E84BB7597AABE663B82F6F04EF2777"},
+}
+
+func TestSecp256k1ScalarBaseMult(t *testing.T) {
+	for _, v := range secp256k1ScalarVectors {
+		k, _ := new(big.Int).SetString(v.k, 16)
+		x, y := secp256k1.ScalarBaseMult(k.Bytes())
+		if x.Text(16) != new(big.Int).SetBytes(decodeHex(t, v.x)).Text(16) || y.Text(16) != new(big.Int).SetBytes(decodeHex(t, v.y)).Text(16) {
+			t.Errorf("%s*G = (%X, %X)", v.k, x, y)
+		}
+		if !secp256k1.IsOnCurve(x, y) {
+			t.Errorf("%s*G is not on the curve", v.k)
+		}
+
+		//与一般的标量乘法和加法的结果一致
+		gx, gy := secp256k1.ScalarMult(secp256k1.params.Gx, secp256k1.params.Gy, k.Bytes())
+		if gx.Cmp(x) != 0 || gy.Cmp(y) != 0 {
+			t.Errorf("ScalarMult(G, %s) differs from ScalarBaseMult", v.k)
+		}
+	}
+
+	//n*G 是无穷远点
+	x, y := secp256k1.ScalarBaseMult(secp256k1.params.N.Bytes())
+	if x.Sign() != 0 || y.Sign() != 0 {
+		t.Errorf("n*G = (%X, %X)", x, y)
+	}
+
+	x2, y2 := secp256k1.Double(secp256k1.params.Gx, secp256k1.params.Gy)
+	x3, y3 := secp256k1.Add(x2, y2, secp256k1.params.Gx, secp256k1.params.Gy)
+	if x3.Text(16) != "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9" || !secp256k1.IsOnCurve(x3, y3) {
+		t.Errorf("2G + G = (%X, %X)", x3, y3)
+	}
+}
+
+func TestSecp256k1SignaturesHaveLowS(t *testing.T) {
+	private := generatePrivateKey(KeyTypeSecp256k1)
+	signer := NewSigner(KeyTypeSecp256k1, &private)
+	verifier, err := ParseVerifier(signer.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	halfN := new(big.Int).Rsh(secp256k1.params.N, 1)
+
+	for i := 0; i < 32; i++ {
+		hash := sha256.Sum256([]byte{byte(i)})
+		signature := signer.Sign(hash[:])
+		if !verifier.Verify(hash[:], signature) {
+			t.Fatalf("signature %d is rejected", i)
+		}
+
+		s := new(big.Int).SetBytes(signature[coordinateLen:])
+		if s.Cmp(halfN) > 0 {
+			t.Fatalf("signature %d has a high s", i)
+		}
+
+		//(r, n-s) 在数学上同样有效，但是不能被接受，否则签名可以被改写
+		high := new(big.Int).Sub(secp256k1.params.N, s)
+		malleated := append(append([]byte{}, signature[:coordinateLen]...), high.FillBytes(make([]byte, coordinateLen))...)
+		if verifier.Verify(hash[:], malleated) {
+			t.Fatalf("high-s form of signature %d is accepted", i)
+		}
+	}
+}
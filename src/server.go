@@ -4,31 +4,45 @@ import (
 	"bytes"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
 	"net"
+	"time"
 )
 
 /*
-*接收到 version 消息的节点应该做什么呢？它会响应自己的 version 消息。
+*节点之间建立连接后，双方互相发送 version 消息，收到后回复 verack。
 *这是一种握手：如果没有事先互相问候，就不可能有其他交流。
 *不过，这并不是出于礼貌：version 用于找到一个更长的区块链。当一个节点接收到 version 消息，它会检查本节点的区块链是否比 BestHeight 的值更大。
 *如果不是，节点就会请求并下载缺失的块。
  */
 const protocol = "tcp"
-const nodeVersion = 1
+const nodeVersion = 2
 const commandLength = 12
+const magicLength = 4
 
 var nodeAddress string
 
 //minerAddress 参数指定了接收挖矿奖励的地址
 var miningAddress string
-var knownNodes = []string{"localhost:3000"}
+//种子节点，节点启动时把它们加入地址管理器
+var knownNodes = append([]string(nil), MainNetParams.SeedNodes...)
 var blockInTransit = [][]byte{}
 var mempool = make(map[string]Transaction)
 
+//内存池中交易花费的输出 txid:vout 和花费它的交易 ID，与内存池中的交易花费同一个输出的交易不能进入内存池
+var mempoolSpends = make(map[string]string)
+
+//内存池最多保存的交易数，没有手续费，满了以后拒绝新的交易
+const maxMempoolSize = 5000
+
+//已经发出 getdata 还没有收到的交易，避免向多个节点重复请求同一笔交易
+//对方在 txRequestTimeout 内没有回复时可以向其他节点重新请求
+var txRequested = make(map[string]time.Time)
+
+const txRequestTimeout = 2 * time.Minute
+
 type addr struct {
 	AddrList []string
 }
@@ -63,11 +77,18 @@ type tx struct {
 }
 
 //BestHeight： 存储区块链中节点的高度。
-//AddFrom： 存储发送者的地址。
+//AddFrom： 存储发送者的监听地址，命令行发送交易时为空。
+//Nonce： 发送者的随机数，用来发现连接到了自己。
 type verzion struct {
 	Version    int
 	BestHeight int
 	AddrFrom   string
+	Nonce      uint64
+}
+
+//ping 和 pong 使用相同的格式，pong 带回 ping 中的随机数
+type ping struct {
+	Nonce uint64
 }
 
 //将string类型的命令转换成[]byte
@@ -94,396 +115,740 @@ func bytesToCommand(bytes []byte) string {
 	return fmt.Sprintf("%s", command)
 }
 
-//从[]byte中提取出命令
-func extractCommand(request []byte) []byte {
-	return request[:commandLength]
-}
-
-func requestBlocks() {
-	for _, node := range knownNodes {
-		sendGetBlocks(node)
-	}
-}
-
 //发送地址信息
-func sendAddr(address string) {
-	nodes := addr{knownNodes}
-	nodes.AddrList = append(nodes.AddrList, nodeAddress)
-	payload := gobEncode(nodes)
-	request := append(commandToBytes("addr"), payload...)
+func sendAddr(p *Peer, addrs []string) {
+	p.Send("addr", gobEncode(addr{addrs}))
+}
 
-	sendData(address, request)
+//向出站连接请求它知道的地址
+func sendGetAddr(p *Peer) {
+	p.Send("getaddr", nil)
 }
 
 //发送块
-func sendBlock(addr string, b *Block) {
+func sendBlock(p *Peer, b *Block) {
 	data := block{nodeAddress, b.Serialize()}
-	payload := gobEncode(data)
-	request := append(commandToBytes("block"), payload...)
 
-	sendData(addr, request)
+	p.Send("block", gobEncode(data))
 }
 
-//发送数据
-func sendData(addr string, data []byte) {
-	//使用tcp方式与特定端口进行通信
-	conn, err := net.Dial(protocol, addr)
-	if err != nil {
-		fmt.Printf("%s is not available\n", addr)
-		var updatedNodes []string
-
-		//更新地址
-		for _, node := range knownNodes {
-			if node != addr {
-				updatedNodes = append(updatedNodes, node)
-			}
-		}
-
-		knownNodes = updatedNodes
-
-		return
+//发送清单
+func sendInv(p *Peer, kind string, items [][]byte) {
+	for _, item := range items {
+		p.AddKnownInventory(kind, item)
 	}
-	defer conn.Close()
+	inventory := inv{nodeAddress, kind, items}
 
-	_, err = io.Copy(conn, bytes.NewReader(data))
-	if err != nil {
-		log.Panic(err)
-	}
+	p.Send("inv", gobEncode(inventory))
 }
 
-//发送清单
-func sendInv(address, kind string, items [][]byte) {
-	inventory := inv{nodeAddress, kind, items}
-	payload := gobEncode(inventory)
-	request := append(commandToBytes("inv"), payload...)
-
-	sendData(address, request)
+//把新的块或交易转发给除了来源以外的所有节点，已经知道它的节点不再发送，这样消息不会在网络中循环
+//from 为 nil 时是本节点产生的块或交易
+func relayInventory(kind string, id []byte, from *Peer) {
+	for _, p := range peerManager.Peers() {
+		if p != from && !p.KnowsInventory(kind, id) {
+			sendInv(p, kind, [][]byte{id})
+		}
+	}
 }
 
-func sendGetBlocks(address string) {
-	payload := gobEncode(getblocks{nodeAddress})
-	request := append(commandToBytes("getblocks"), payload...)
+//把成为链尾的新区块转发给除了来源以外的所有节点，支持紧凑区块的节点收到 cmpctblock，其他节点收到 inv
+func relayBlock(b *Block, from *Peer) {
+	var cmpct []byte
+	for _, p := range peerManager.Peers() {
+		if p == from || p.KnowsInventory("block", b.Hash) {
+			continue
+		}
+		//第一笔交易不是 coinbase 的块（旧版本挖出的块）无法构造紧凑区块
+		if !p.SupportsCompactBlocks() || !b.Transactions[0].IsCoinbase() {
+			sendInv(p, "block", [][]byte{b.Hash})
+			continue
+		}
 
-	sendData(address, request)
+		if cmpct == nil {
+			cmpct = gobEncode(newCompactBlock(b))
+		}
+		sendCmpctBlock(p, cmpct, b.Hash)
+	}
 }
 
-func sendGetData(address, kind string, id []byte) {
-	payload := gobEncode(getdata{nodeAddress, kind, id})
-	request := append(commandToBytes("getdata"), payload...)
+func sendGetBlocks(p *Peer) {
+	p.Send("getblocks", gobEncode(getblocks{nodeAddress}))
+}
 
-	sendData(address, request)
+func sendGetData(p *Peer, kind string, id []byte) {
+	p.Send("getdata", gobEncode(getdata{nodeAddress, kind, id}))
 }
 
 //发送交易
-func sendTx(addr string, tnx *Transaction) {
+func sendTx(p *Peer, tnx *Transaction) {
 	data := tx{nodeAddress, tnx.Serialize()}
-	payload := gobEncode(data)
-	request := append(commandToBytes("tx"), payload...)
 
-	sendData(addr, request)
+	p.Send("tx", gobEncode(data))
 }
 
-//如果当前节点不是中心节点，它必须向中心节点发送 version 消息来查询是否自己的区块链已过时
-func sendVersion(addr string, bc *Blockchain) {
+//连接建立后双方都发送 version，告诉对方自己的区块链高度
+func sendVersion(p *Peer, bc *Blockchain) {
 	bestHeight := bc.GetBestHeight()
-	payload := gobEncode(verzion{nodeVersion, bestHeight, nodeAddress})
-
-	request := append(commandToBytes("version"), payload...)
 
-	sendData(addr, request)
+	p.Send("version", gobEncode(verzion{nodeVersion, bestHeight, nodeAddress, localNonce}))
 }
 
-func handleAddr(request []byte) {
+func handleAddr(p *Peer, request []byte) error {
 	//我们需要对请求进行解码，提取有效信息。所有的处理器在这部分都类似。
 	var buff bytes.Buffer
 	var payload addr
 
-	buff.Write(request[commandLength:])
+	buff.Write(request)
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return misbehaving(misbehaviorMalformed, "malformed addr message: %s", err)
+	}
+
+	if len(payload.AddrList) > maxAddrPerMessage {
+		return misbehaving(misbehaviorTooManyAddr, "addr message with %d addresses", len(payload.AddrList))
+	}
+
+	//每个连接添加的新地址有上限，防止一个节点用大量地址挤掉其他地址
+	p.mu.Lock()
+	limit := maxAddrPerPeer - p.addrAdded
+	p.mu.Unlock()
+
+	added := addrManager.Add(payload.AddrList, limit)
+	p.mu.Lock()
+	p.addrAdded += added
+	p.mu.Unlock()
+	if added > 0 {
+		logInfo("There are %d known nodes now!", addrManager.Count())
 	}
 
-	knownNodes = append(knownNodes, payload.AddrList...)
-	fmt.Printf("There are %d known nodes now!\n", len(knownNodes))
-	requestBlocks()
+	return nil
+}
+
+//回复一部分已知的地址
+func handleGetAddr(p *Peer) {
+	sendAddr(p, addrManager.Sample(maxAddrPerMessage))
 }
 
 //当接收到一个新块时，我们把它放到区块链里面
 //如果还有更多的区块需要下载，我们继续从上一个下载的块的那个节点继续请求
 //当最后把所有块都下载完后，对 UTXO 集进行重新索引
-func handleBlock(request []byte, bc *Blockchain) {
+func handleBlock(p *Peer, request []byte, bc *Blockchain) error {
 	var buff bytes.Buffer
 	var payload block
 
-	buff.Write(request[commandLength:])
+	buff.Write(request)
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return misbehaving(misbehaviorMalformed, "malformed block message: %s", err)
 	}
 
 	blockData := payload.Block
-	block := DeserializeBlock(blockData)
+	block, err := ParseBlock(blockData)
+	if err != nil {
+		return misbehaving(misbehaviorMalformed, "malformed block: %s", err)
+	}
+
+	return processBlock(p, block, bc)
+}
+
+//处理收到的完整的块或用紧凑区块重建的块
+func processBlock(p *Peer, block *Block, bc *Blockchain) error {
+	p.AddKnownInventory("block", block.Hash)
+	delete(partialBlocks, hex.EncodeToString(block.Hash))
+
+	logDebug("Recevied a new block!")
+
+	//已经有的块不再处理，但继续下载其他的块
+	if _, err := bc.GetBlock(block.Hash); err == nil {
+		requestNextBlock(p)
+		return nil
+	}
+
+	//只接受接在链尾的块，区块按链的顺序逐个检查并更新 UTXO 集
+	if !bytes.Equal(block.PrevBlockHash, bc.tip) {
+		if _, err := bc.GetBlock(block.PrevBlockHash); err == nil {
+			//父块已知但不是链尾，说明对方在另一个分叉上，不支持重组，停止从对方下载
+			logDebug("Ignored block %x that does not extend the tip", block.Hash)
+			blockInTransit = nil
+			return nil
+		}
+
+		//父块未知，说明本节点落后了，不保存这个块，向对方请求缺少的块
+		logDebug("Block %x has an unknown parent", block.Hash)
+		if !requestNextBlock(p) {
+			sendGetBlocks(p)
+		}
+		return nil
+	}
 
-	fmt.Println("Recevied a new block!")
+	//块本身无效是对方的问题；依赖本节点 UTXO 集的检查失败可能只是双方的状态不同，只拒绝这个块
+	err := CheckBlockSanity(block)
+	if err != nil {
+		return misbehaving(misbehaviorInvalidBlock, "invalid block %x: %s", block.Hash, err)
+	}
+	err = CheckBlock(block, UTXOSet{bc})
+	if err != nil {
+		logWarn("Rejected block %x: %s", block.Hash, err)
+		return nil
+	}
 	bc.AddBlock(block)
 
-	fmt.Printf("Added block %x\n", block.Hash)
+	UTXOSet := UTXOSet{bc}
+	UTXOSet.Update(block)
+	removeBlockFromMempool(block)
 
-	if len(blockInTransit) > 0 {
-		blockHash := blockInTransit[0]
-		sendGetData(payload.AddrFrom, "block", blockHash)
+	logInfo("Added block %x", block.Hash)
 
-		blockInTransit = blockInTransit[1:]
-	} else {
-		UTXOSet := UTXOSet{bc}
-		//UTXOSet.Reindex()
-		UTXOSet.Update(block)
+	//同步历史区块时不转发，新区块成为链尾时转发给其他节点
+	if !requestNextBlock(p) {
+		relayBlock(block, p)
 	}
+
+	return nil
 }
 
-func handleInv(request []byte, bc *Blockchain) {
+func handleInv(p *Peer, request []byte, bc *Blockchain) error {
 	var buff bytes.Buffer
 	var payload inv
 
-	buff.Write(request[commandLength:])
+	buff.Write(request)
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return misbehaving(misbehaviorMalformed, "malformed inv message: %s", err)
 	}
 
-	fmt.Printf("Recevied inventory with %d %s\n", len(payload.Items), payload.Type)
+	logDebug("Recevied inventory with %d %s", len(payload.Items), payload.Type)
+
+	for _, item := range payload.Items {
+		p.AddKnownInventory(payload.Type, item)
+	}
 
 	//如果收到块哈希，我们想要将它们保存在 blocksInTransit 变量来跟踪已下载的块。这能够让我们从不同的节点下载块
+	//已经有的块和正在下载的块不再请求
 	//在将块置于传送状态时，我们给 inv 消息的发送者发送 getdata 命令并更新 blocksInTransit
 	if payload.Type == "block" {
-		blockInTransit = payload.Items
+		var newBlocks [][]byte
+		for _, b := range payload.Items {
+			if _, err := bc.GetBlock(b); err != nil && !blockIsInTransit(b) {
+				newBlocks = append(newBlocks, b)
+			}
+		}
+		if len(newBlocks) == 0 {
+			return nil
+		}
 
-		blockHash := payload.Items[0]
-		sendGetData(payload.AddrFrom, "block", blockHash)
+		sendGetData(p, "block", newBlocks[0])
+		blockInTransit = append(blockInTransit, newBlocks[1:]...)
+	}
 
-		newInTransit := [][]byte{}
-		for _, b := range blockInTransit {
-			if bytes.Compare(b, blockHash) != 0 {
-				newInTransit = append(newInTransit, b)
+	//检查是否在内存池中已经有了这个交易，或者已经向其他节点请求过，如果没有，发送 getdata 消息。
+	if payload.Type == "tx" {
+		for _, txID := range payload.Items {
+			id := hex.EncodeToString(txID)
+			if _, ok := mempool[id]; ok {
+				continue
+			}
+			if requested, ok := txRequested[id]; ok && time.Since(requested) < txRequestTimeout {
+				continue
 			}
+
+			txRequested[id] = time.Now()
+			sendGetData(p, "tx", txID)
 		}
-		blockInTransit = newInTransit
 	}
 
-	//在我们的实现中，我们永远也不会发送有多重哈希的 inv。
-	//这就是为什么当 payload.Type == "tx" 时，只会拿到第一个哈希。
-	//然后我们检查是否在内存池中已经有了这个哈希，如果没有，发送 getdata 消息。
-	if payload.Type == "tx" {
-		txID := payload.Items[0]
+	return nil
+}
+
+//向 p 请求下一个待下载的块，没有待下载的块时返回 false
+func requestNextBlock(p *Peer) bool {
+	if len(blockInTransit) == 0 {
+		return false
+	}
+
+	blockHash := blockInTransit[0]
+	sendGetData(p, "block", blockHash)
+	blockInTransit = blockInTransit[1:]
+
+	return true
+}
 
-		if mempool[hex.EncodeToString(txID)].ID == nil {
-			sendGetData(payload.AddrFrom, "tx", txID)
+func blockIsInTransit(hash []byte) bool {
+	for _, b := range blockInTransit {
+		if bytes.Equal(b, hash) {
+			return true
 		}
 	}
+
+	return false
 }
 
-func handleGetBlocks(request []byte, bc *Blockchain) {
+func handleGetBlocks(p *Peer, request []byte, bc *Blockchain) error {
 	var buff bytes.Buffer
 	var payload getblocks
 
-	buff.Write(request[commandLength:])
+	buff.Write(request)
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return misbehaving(misbehaviorMalformed, "malformed getblocks message: %s", err)
 	}
 
+	//区块按链的顺序发送，对方依次下载时每个块都接在它的链尾
 	blocks := bc.GetBlockHashes()
-	sendInv(payload.AddrFrom, "block", blocks)
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	sendInv(p, "block", blocks)
+
+	return nil
 }
 
 //如果它们请求一个块，则返回块；如果它们请求一笔交易，则返回交易。
-func handleGetData(request []byte, bc *Blockchain) {
+func handleGetData(p *Peer, request []byte, bc *Blockchain) error {
 	var buff bytes.Buffer
 	var payload getdata
 
-	buff.Write(request[commandLength:])
+	buff.Write(request)
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return misbehaving(misbehaviorMalformed, "malformed getdata message: %s", err)
 	}
 
 	if payload.Type == "block" {
 		block, err := bc.GetBlock([]byte(payload.ID))
 		if err != nil {
-			return
+			return nil
 		}
 
-		sendBlock(payload.AddrFrom, &block)
+		sendBlock(p, &block)
 	}
 
 	if payload.Type == "tx" {
 		txID := hex.EncodeToString(payload.ID)
-		tx := mempool[txID]
+		tx, ok := mempool[txID]
+		if !ok {
+			return nil
+		}
 
-		sendTx(payload.AddrFrom, &tx)
+		sendTx(p, &tx)
 	}
+
+	return nil
 }
 
-func handleTx(request []byte, bc *Blockchain) {
+func handleTx(p *Peer, request []byte, bc *Blockchain) error {
 	var buff bytes.Buffer
 	var payload tx
 
-	buff.Write(request[commandLength:])
+	buff.Write(request)
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return misbehaving(misbehaviorMalformed, "malformed tx message: %s", err)
 	}
 
 	//首先要做的事情是将新交易放到内存池中（再次提醒，在将交易放到内存池之前，必要对其进行验证）
 	txData := payload.Transaction
-	tx := DeserializeTransaction(txData)
-	mempool[hex.EncodeToString(tx.ID)] = tx
-
-	//检查当前节点是否是中心节点。在我们的实现中，中心节点并不会挖矿。它只会将新的交易推送给网络中的其他节点。
-	if nodeAddress == knownNodes[0] {
-		for _, node := range knownNodes {
-			if node != nodeAddress && node != payload.AddrFrom {
-				sendInv(node, "tx", [][]byte{tx.ID})
-			}
+	tx, err := ParseTransaction(txData)
+	if err != nil {
+		return misbehaving(misbehaviorMalformed, "malformed transaction: %s", err)
+	}
+	id := hex.EncodeToString(tx.ID)
+	p.AddKnownInventory("tx", tx.ID)
+	delete(txRequested, id)
+
+	if _, ok := mempool[id]; ok {
+		return nil
+	}
+	//共识规则不允许的交易和签名错误的交易会增加对方的违规分数，输入不存在或已被花费可能只是双方的状态不同
+	err = acceptToMempool(&tx, bc)
+	if _, ok := err.(*Misbehavior); ok {
+		return err
+	}
+	if err != nil {
+		logWarn("Rejected transaction %x: %s", tx.ID, err)
+		return nil
+	}
+
+	//每个节点都把通过验证的新交易转发给其他节点
+	relayInventory("tx", tx.ID, p)
+
+	//miningAddress 只会在矿工节点上设置。
+	//如果当前节点（矿工）的内存池中有两笔或更多的交易，开始挖矿
+	if len(mempool) >= 2 && len(miningAddress) > 0 {
+	MineTransactions:
+		//内存池中所有交易都是通过验证的。无效的交易会被忽略，如果没有有效交易，则挖矿中断
+		txs := selectMempoolTransactions(bc)
+		if len(txs) == 0 {
+			logWarn("All transactions are invalid! Waiting for new ones...")
+			return nil
 		}
-	} else {
-		//miningAddress 只会在矿工节点上设置。
-		//如果当前节点（矿工）的内存池中有两笔或更多的交易，开始挖矿
-		if len(mempool) >= 2 && len(miningAddress) > 0 {
-		MineTransactions:
-			var txs []*Transaction
-
-			//内存池中所有交易都是通过验证的。无效的交易会被忽略，如果没有有效交易，则挖矿中断
-			for id := range mempool {
-				tx := mempool[id]
-				if bc.VerifyTransaction(&tx) {
-					txs = append(txs, &tx)
-				}
-			}
 
-			if len(txs) == 0 {
-				fmt.Println("All transactions are invalid! Waiting for new ones...")
-				return
-			}
+		newBlock := mineBlock(bc, txs, miningAddress)
 
-			//验证后的交易被放到一个块里，同时还有附带奖励的 coinbase 交易。当块被挖出来以后，UTXO 集会被重新索引。
-			cbTx := NewCoinbaseTX(miningAddress, "")
-			txs = append(txs, cbTx)
+		logInfo("New block is mined!")
 
-			newBlock := bc.MineBlock(txs)
-			UTXOSet := UTXOSet{bc}
-			//UTXOSet.Reindex()
-			UTXOSet.Update(newBlock)
+		//当前节点所连接到的所有其他节点接收紧凑区块，用内存池中的交易重建它，只请求缺少的交易
+		broadcastBlock(newBlock)
 
-			fmt.Println("New block is mined!")
+		if len(mempool) > 0 {
+			goto MineTransactions
+		}
+	}
 
-			//当一笔交易被挖出来以后，就会被从内存池中移除。
-			//当前节点所连接到的所有其他节点，接收带有新块哈希的 inv 消息。
-			//在处理完消息后，它们可以对块进行请求
-			for _, tx := range txs {
-				txID := hex.EncodeToString(tx.ID)
-				delete(mempool, txID)
-			}
+	return nil
+}
 
-			for _, node := range knownNodes {
-				if node != nodeAddress {
-					sendInv(node, "block", [][]byte{newBlock.Hash})
-				}
-			}
+//区块中交易序列化后的总大小上限，留出余量使区块消息不超过 maxMessagePayload
+const maxBlockTxSize = maxMessagePayload / 2
+
+//选出内存池中可以打包进下一个区块的交易，无效的交易从内存池中删除
+//内存池中的交易不会花费同一个输出，但上一个区块挖出后，其中的交易可能已经失效
+//放不进这个区块的交易留在内存池中，等待下一个区块
+func selectMempoolTransactions(bc *Blockchain) []*Transaction {
+	var txs []*Transaction
+
+	UTXOSet := UTXOSet{bc}
+	height := bc.GetBestHeight() + 1
+	size := 0
+	for id := range mempool {
+		tx := mempool[id]
+		_, err := CheckTxInputs(&tx, UTXOSet, height)
+		if err != nil || !bc.VerifyTransaction(&tx) {
+			removeFromMempool(id)
+			continue
+		}
+
+		txSize := len(tx.Serialize())
+		if size+txSize > maxBlockTxSize {
+			continue
+		}
+		size += txSize
+		txs = append(txs, &tx)
+	}
+
+	return txs
+}
+
+//挖出一个包含 txs 和 coinbase 奖励的区块，奖励发给 address
+//验证后的交易被放到一个块里，同时还有附带奖励的 coinbase 交易。当块被挖出来以后，UTXO 集会被更新。
+//当一笔交易被挖出来以后，就会被从内存池中移除。
+func mineBlock(bc *Blockchain, txs []*Transaction, address string) *Block {
+	//coinbase 交易放在块的第一个位置，紧凑区块只预先填充这个位置的交易
+	cbTx := NewCoinbaseTX(address, "")
+	txs = append([]*Transaction{cbTx}, txs...)
+
+	newBlock := bc.MineBlock(txs)
+	UTXOSet := UTXOSet{bc}
+	//UTXOSet.Reindex()
+	UTXOSet.Update(newBlock)
+	removeBlockFromMempool(newBlock)
+
+	return newBlock
+}
+
+//向所有连接的节点发送本节点挖出的新区块
+func broadcastBlock(newBlock *Block) {
+	relayBlock(newBlock, nil)
+}
+
+//立即挖出 n 个区块，奖励都发给 address，每个区块打包内存池中当时所有有效的交易
+//回归测试网络的难度为 0，每个区块只计算一次哈希，测试可以很快地推进区块链
+func generateBlocks(bc *Blockchain, n int, address string) []*Block {
+	var blocks []*Block
+
+	for i := 0; i < n; i++ {
+		txs := selectMempoolTransactions(bc)
+		blocks = append(blocks, mineBlock(bc, txs, address))
+	}
+
+	return blocks
+}
+
+//交易进入内存池之前必须通过共识检查、UTXO集检查和签名验证
+//违反共识规则和签名错误时返回 *Misbehavior，交易来自其他节点时增加它的违规分数
+func acceptToMempool(tx *Transaction, bc *Blockchain) error {
+	err := CheckTransaction(tx)
+	if err != nil {
+		return misbehaving(misbehaviorInvalidTx, "%s", err)
+	}
+
+	if tx.IsCoinbase() {
+		return misbehaving(misbehaviorInvalidTx, "Coinbase transaction is not allowed in mempool.")
+	}
+
+	//先到的交易优先，与它冲突的交易可能只是对方还没有收到它
+	for _, vin := range tx.Vin {
+		outpoint := fmt.Sprintf("%x:%d", vin.Txid, vin.Vout)
+		if other, ok := mempoolSpends[outpoint]; ok {
+			return fmt.Errorf("Input %s is already spent by %s in the mempool.", outpoint, other)
+		}
+	}
+	if len(mempool) >= maxMempoolSize {
+		return errors.New("Mempool is full.")
+	}
+	//放不进区块的交易永远不会被打包
+	if len(tx.Serialize()) > maxBlockTxSize {
+		return errors.New("Transaction is too large.")
+	}
+
+	_, err = CheckTxInputs(tx, UTXOSet{bc}, bc.GetBestHeight()+1)
+	if err != nil {
+		return err
+	}
+
+	if !bc.VerifyTransaction(tx) {
+		return misbehaving(misbehaviorInvalidTx, "Transaction has an invalid signature.")
+	}
+
+	addToMempool(tx)
+
+	return nil
+}
+
+//把交易加入内存池，并记录它花费的输出
+func addToMempool(tx *Transaction) {
+	id := hex.EncodeToString(tx.ID)
+	mempool[id] = *tx
+	for _, vin := range tx.Vin {
+		mempoolSpends[fmt.Sprintf("%x:%d", vin.Txid, vin.Vout)] = id
+	}
+}
+
+//从内存池中删除交易和它花费的输出的记录
+func removeFromMempool(id string) {
+	tx, ok := mempool[id]
+	if !ok {
+		return
+	}
+
+	for _, vin := range tx.Vin {
+		delete(mempoolSpends, fmt.Sprintf("%x:%d", vin.Txid, vin.Vout))
+	}
+	delete(mempool, id)
+}
+
+//区块加入链尾后，从内存池中删除区块中的交易，以及和它们花费同一个输出的交易
+func removeBlockFromMempool(block *Block) {
+	for _, tx := range block.Transactions {
+		removeFromMempool(hex.EncodeToString(tx.ID))
+		if tx.IsCoinbase() {
+			continue
+		}
 
-			if len(mempool) > 0 {
-				goto MineTransactions
+		for _, vin := range tx.Vin {
+			if other, ok := mempoolSpends[fmt.Sprintf("%x:%d", vin.Txid, vin.Vout)]; ok {
+				removeFromMempool(other)
 			}
 		}
 	}
 }
 
-func handleVersion(request []byte, bc *Blockchain) {
+//握手：入站连接先收到对方的 version，回复自己的 version；双方收到 version 后都回复 verack
+func handleVersion(p *Peer, request []byte, bc *Blockchain) error {
 	var buff bytes.Buffer
 	var payload verzion
 
-	buff.Write(request[commandLength:])
+	buff.Write(request)
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return misbehaving(misbehaviorMalformed, "malformed version message: %s", err)
+	}
+
+	if payload.Nonce == localNonce {
+		return errors.New("connected to self")
 	}
 
-	//节点将从消息中提取的 BestHeight 与自身进行比较。如果自身节点的区块链更长，它会回复 version 消息；否则，它会发送 getblocks 消息
+	p.mu.Lock()
+	if p.versionReceived {
+		p.mu.Unlock()
+		return errors.New("duplicate version message")
+	}
+	p.versionReceived = true
+	p.version = payload.Version
+	p.bestHeight = payload.BestHeight
+	p.mu.Unlock()
+
+	if p.inbound {
+		sendVersion(p, bc)
+	}
+	p.Send("verack", nil)
+
+	//节点将从消息中提取的 BestHeight 与自身进行比较。如果对方的区块链更长，发送 getblocks 消息
+	//对方也收到了本节点的 version，如果本节点的区块链更长，由对方请求
 	myBestHeight := bc.GetBestHeight()
 	foreignerBestHeight := payload.BestHeight
 
 	if myBestHeight < foreignerBestHeight {
-		sendGetBlocks(payload.AddrFrom)
-	} else if myBestHeight > foreignerBestHeight {
-		sendVersion(payload.AddrFrom, bc)
+		sendGetBlocks(p)
+	}
+
+	//入站连接用连接的对方地址标识，AddrFrom 只是对方声明的监听地址，加入地址管理器等以后连接时验证
+	//从出站连接获取更多的地址
+	if p.inbound {
+		addrManager.Add([]string{payload.AddrFrom}, 1)
+	} else {
+		sendGetAddr(p)
 	}
 
-	if !nodeIsKnown(payload.AddrFrom) {
-		knownNodes = append(knownNodes, payload.AddrFrom)
+	return nil
+}
+
+func handleVerack(p *Peer) error {
+	p.mu.Lock()
+	if p.verackReceived {
+		p.mu.Unlock()
+		return errors.New("duplicate verack message")
+	}
+	p.verackReceived = true
+	p.mu.Unlock()
+
+	if !p.inbound {
+		addrManager.Good(p.Addr())
+	}
+	logInfo("Connected to %s", p)
+
+	return nil
+}
+
+func handlePing(p *Peer, request []byte) error {
+	var buff bytes.Buffer
+	var payload ping
+
+	buff.Write(request)
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return misbehaving(misbehaviorMalformed, "malformed ping message: %s", err)
 	}
+
+	p.Send("pong", gobEncode(payload))
+
+	return nil
 }
 
-//对不同指令的操作
-func handleConnection(conn net.Conn, bc *Blockchain) {
-	request, err := ioutil.ReadAll(conn)
+func handlePong(p *Peer, request []byte) error {
+	var buff bytes.Buffer
+	var payload ping
+
+	buff.Write(request)
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		return misbehaving(misbehaviorMalformed, "malformed pong message: %s", err)
 	}
-	command := bytesToCommand(request[:commandLength])
-	fmt.Printf("Received %s command\n", command)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pingOutstanding && payload.Nonce == p.pingNonce {
+		p.pingOutstanding = false
+	}
+
+	return nil
+}
+
+//对不同指令的操作，返回错误时断开连接
+//握手完成之前只接受 version 和 verack
+//处理消息返回的 *Misbehavior 增加对方的违规分数，达到 banscore 时断开连接并禁止对方
+func handleMessage(p *Peer, msg *message, bc *Blockchain) error {
+	err := dispatchMessage(p, msg, bc)
+	if m, ok := err.(*Misbehavior); ok {
+		return p.Misbehaving(m)
+	}
+
+	return err
+}
+
+func dispatchMessage(p *Peer, msg *message, bc *Blockchain) error {
+	request := msg.Payload
+	command := msg.Command
+	logDebug("Received %s command from %s", command, p)
+
+	switch command {
+	case "version":
+		nodeMu.Lock()
+		defer nodeMu.Unlock()
+		return handleVersion(p, request, bc)
+	case "verack":
+		return handleVerack(p)
+	}
+
+	if !p.HandshakeDone() {
+		return fmt.Errorf("%s message before handshake", command)
+	}
+
+	nodeMu.Lock()
+	defer nodeMu.Unlock()
 
 	switch command {
 	case "addr":
-		handleAddr(request)
+		return handleAddr(p, request)
 	case "block":
-		handleBlock(request, bc)
+		return handleBlock(p, request, bc)
+	case "cmpctblock":
+		return handleCmpctBlock(p, request, bc)
+	case "getblocktxn":
+		return handleGetBlockTxn(p, request, bc)
+	case "blocktxn":
+		return handleBlockTxn(p, request, bc)
 	case "inv":
-		handleInv(request, bc)
+		return handleInv(p, request, bc)
 	case "getblocks":
-		handleGetBlocks(request, bc)
+		return handleGetBlocks(p, request, bc)
+	case "getaddr":
+		handleGetAddr(p)
 	case "getdata":
-		handleGetData(request, bc)
+		return handleGetData(p, request, bc)
 	case "tx":
-		handleTx(request, bc)
-	case "version":
-		handleVersion(request, bc)
+		return handleTx(p, request, bc)
+	case "ping":
+		return handlePing(p, request)
+	case "pong":
+		return handlePong(p, request)
 	default:
-		fmt.Println("Unknown command!")
+		logWarn("Unknown command %s from %s", command, p)
 	}
 
-	conn.Close()
+	return nil
 }
 
 //打开服务器
 func StartServer(nodeID, minerAddress string) {
-	nodeAddress = fmt.Sprintf("localhost:%s", nodeID)
+	nodeAddress = activeConfig.External
 	miningAddress = minerAddress
-	ln, err := net.Listen(protocol, nodeAddress)
+	ln, err := net.Listen(protocol, activeConfig.Listen)
 	if err != nil {
 		log.Panic(err)
 	}
 	defer ln.Close()
 
 	bc := NewBlockchain(nodeID)
-
-	if nodeAddress != knownNodes[0] {
-		sendVersion(knownNodes[0], bc)
+	if activeConfig.RPCEnabled {
+		StartRPCServer(nodeID, bc)
 	}
 
+	banManager = NewBanManager(banListPath(nodeID))
+	banManager.Load()
+	addrManager = NewAddrManager(peersPath(nodeID))
+	addrManager.Load()
+	addrManager.AddSeeds(knownNodes)
+	go addrManager.Run()
+	go peerManager.Run(bc)
+
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
 			log.Panic(err)
 		}
-		go handleConnection(conn, bc)
+		peerManager.Accept(conn, bc)
 	}
 }
 
@@ -499,14 +864,3 @@ func gobEncode(data interface{}) []byte {
 
 	return buff.Bytes()
 }
-
-//检测节点是否已知
-func nodeIsKnown(addr string) bool {
-	for _, node := range knownNodes {
-		if node == addr {
-			return true
-		}
-	}
-
-	return false
-}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+//测试结束后清空内存池
+func resetMempool(t *testing.T) {
+	t.Cleanup(func() {
+		mempool = make(map[string]Transaction)
+		mempoolSpends = make(map[string]string)
+	})
+}
+
+func TestMempoolRejectsConflicts(t *testing.T) {
+	bc, wallet := newTestBlockchain(t)
+	resetMempool(t)
+	first := spendGenesisCoinbase(t, bc, wallet)
+	second := spendGenesisCoinbase(t, bc, wallet)
+	generateBlocks(bc, activeNetParams.CoinbaseMaturity, string(NewWallet().GetAddress()))
+
+	if err := acceptToMempool(first, bc); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, acceptToMempool(second, bc), "already spent by")
+
+	//区块中冲突的交易把内存池中的交易挤出去
+	mineBlock(bc, []*Transaction{second}, string(NewWallet().GetAddress()))
+	if len(mempool) != 0 || len(mempoolSpends) != 0 {
+		t.Errorf("mempool still has %d transactions and %d spends", len(mempool), len(mempoolSpends))
+	}
+}
+
+func TestMempoolIsCapped(t *testing.T) {
+	bc, wallet := newTestBlockchain(t)
+	resetMempool(t)
+	tx := spendGenesisCoinbase(t, bc, wallet)
+	generateBlocks(bc, activeNetParams.CoinbaseMaturity, string(NewWallet().GetAddress()))
+
+	for i := 0; i < maxMempoolSize; i++ {
+		mempool[fmt.Sprint(i)] = Transaction{}
+	}
+	expectError(t, acceptToMempool(tx, bc), "Mempool is full")
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+)
+
+//签名算法的类型，新的类型在公钥前面加上一个字节的标记
+//P-256 ECDSA 的公钥没有标记，这样链上已有的输出和地址保持不变
+type KeyType byte
+
+const (
+	KeyTypeP256      KeyType = 0x00
+	KeyTypeSecp256k1 KeyType = 0x10
+	KeyTypeSchnorr   KeyType = 0x11
+)
+
+//命令行中使用的签名算法名称
+var keyTypes = map[string]KeyType{
+	"p256":      KeyTypeP256,
+	"secp256k1": KeyTypeSecp256k1,
+	"schnorr":   KeyTypeSchnorr,
+}
+
+const defaultKeyType = "p256"
+
+var errUnknownKeyType = errors.New("Unknown key type, use p256, secp256k1 or schnorr.")
+
+//由名称得到签名算法
+func ParseKeyType(name string) (KeyType, error) {
+	keyType, ok := keyTypes[name]
+	if !ok {
+		return 0, errUnknownKeyType
+	}
+
+	return keyType, nil
+}
+
+//签名者持有私钥，为交易的签名数据生成签名
+type Signer interface {
+	KeyType() KeyType
+	PublicKey() []byte
+	Sign(hash []byte) []byte
+}
+
+//验证者由公钥解析得到，验证签名
+type Verifier interface {
+	KeyType() KeyType
+	Verify(hash, signature []byte) bool
+}
+
+//签名算法使用的曲线
+func (t KeyType) Curve() elliptic.Curve {
+	if t == KeyTypeP256 {
+		return elliptic.P256()
+	}
+
+	return secp256k1
+}
+
+func (t KeyType) String() string {
+	for name, keyType := range keyTypes {
+		if keyType == t {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("unknown(%#x)", byte(t))
+}
+
+//判断是否是支持的签名算法
+func (t KeyType) IsValid() bool {
+	return t == KeyTypeP256 || t == KeyTypeSecp256k1 || t == KeyTypeSchnorr
+}
+
+//生成指定签名算法的私钥
+func generatePrivateKey(keyType KeyType) ecdsa.PrivateKey {
+	private, err := ecdsa.GenerateKey(keyType.Curve(), rand.Reader)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return *private
+}
+
+//私钥对应的带类型标记的公钥
+func encodeTypedPublicKey(keyType KeyType, public ecdsa.PublicKey) []byte {
+	switch keyType {
+	case KeyTypeSecp256k1:
+		return append([]byte{byte(KeyTypeSecp256k1)}, elliptic.MarshalCompressed(secp256k1, public.X, public.Y)...)
+	case KeyTypeSchnorr:
+		return append([]byte{byte(KeyTypeSchnorr)}, public.X.FillBytes(make([]byte, coordinateLen))...)
+	}
+
+	return encodePublicKey(public)
+}
+
+//由私钥生成签名者
+func NewSigner(keyType KeyType, private *ecdsa.PrivateKey) Signer {
+	switch keyType {
+	case KeyTypeSecp256k1:
+		return &secp256k1Signer{private}
+	case KeyTypeSchnorr:
+		return &schnorrSigner{private}
+	}
+
+	return &p256Signer{private}
+}
+
+//由交易输入中的公钥得到验证者，根据标记选择签名算法，没有标记的公钥是 P-256 公钥
+//旧格式的 P-256 公钥第一个字节可能与标记相同，但它的长度与带标记的公钥不同，因此同时检查长度
+func ParseVerifier(pubKey []byte) (Verifier, error) {
+	if len(pubKey) == 0 {
+		return nil, errInvalidPubKey
+	}
+
+	switch {
+	case KeyType(pubKey[0]) == KeyTypeSecp256k1 && len(pubKey) == 1+compressedPubKeyLen:
+		x, y := unmarshalSecp256k1(pubKey[1:])
+		if x == nil {
+			return nil, errInvalidPubKey
+		}
+		return &secp256k1Verifier{x, y}, nil
+	case KeyType(pubKey[0]) == KeyTypeSchnorr && len(pubKey) == 1+schnorrPubKeyLen:
+		if _, err := secp256k1.liftX(new(big.Int).SetBytes(pubKey[1:])); err != nil {
+			return nil, errInvalidPubKey
+		}
+		return &schnorrVerifier{pubKey[1:]}, nil
+	}
+
+	public, err := ParsePubKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p256Verifier{public}, nil
+}
+
+//P-256 ECDSA，签名是固定 64 字节的 r || s
+type p256Signer struct {
+	private *ecdsa.PrivateKey
+}
+
+func (s *p256Signer) KeyType() KeyType {
+	return KeyTypeP256
+}
+
+func (s *p256Signer) PublicKey() []byte {
+	return encodePublicKey(s.private.PublicKey)
+}
+
+func (s *p256Signer) Sign(hash []byte) []byte {
+	r, sig, err := ecdsa.Sign(rand.Reader, s.private, hash)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return encodeSignature(r, sig)
+}
+
+type p256Verifier struct {
+	public *ecdsa.PublicKey
+}
+
+func (v *p256Verifier) KeyType() KeyType {
+	return KeyTypeP256
+}
+
+func (v *p256Verifier) Verify(hash, signature []byte) bool {
+	return verifySignature(v.public, hash, signature)
+}
+
+//secp256k1 ECDSA，签名是固定 64 字节的 r || s，并且要求 s 不超过 n/2，防止签名被修改成另一个有效签名
+type secp256k1Signer struct {
+	private *ecdsa.PrivateKey
+}
+
+func (s *secp256k1Signer) KeyType() KeyType {
+	return KeyTypeSecp256k1
+}
+
+func (s *secp256k1Signer) PublicKey() []byte {
+	return encodeTypedPublicKey(KeyTypeSecp256k1, s.private.PublicKey)
+}
+
+func (s *secp256k1Signer) Sign(hash []byte) []byte {
+	N := secp256k1.params.N
+	z := new(big.Int).SetBytes(hash)
+
+	for {
+		k := randScalar(N)
+		x, _ := secp256k1.ScalarBaseMult(k.Bytes())
+		r := new(big.Int).Mod(x, N)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		sig := new(big.Int).Mul(r, s.private.D)
+		sig.Add(sig, z)
+		sig.Mul(sig, new(big.Int).ModInverse(k, N))
+		sig.Mod(sig, N)
+		if sig.Sign() == 0 {
+			continue
+		}
+		if sig.Cmp(new(big.Int).Rsh(N, 1)) > 0 {
+			sig.Sub(N, sig)
+		}
+
+		return encodeSignature(r, sig)
+	}
+}
+
+type secp256k1Verifier struct {
+	x, y *big.Int
+}
+
+func (v *secp256k1Verifier) KeyType() KeyType {
+	return KeyTypeSecp256k1
+}
+
+func (v *secp256k1Verifier) Verify(hash, signature []byte) bool {
+	N := secp256k1.params.N
+	if len(signature) != signatureLen {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(signature[:coordinateLen])
+	s := new(big.Int).SetBytes(signature[coordinateLen:])
+	if r.Sign() == 0 || r.Cmp(N) >= 0 || s.Sign() == 0 || s.Cmp(new(big.Int).Rsh(N, 1)) > 0 {
+		return false
+	}
+
+	w := new(big.Int).ModInverse(s, N)
+	u1 := new(big.Int).SetBytes(hash)
+	u1.Mul(u1, w)
+	u1.Mod(u1, N)
+	u2 := new(big.Int).Mul(r, w)
+	u2.Mod(u2, N)
+
+	points := []jacobianPoint{
+		secp256k1.fromAffine(secp256k1.params.Gx, secp256k1.params.Gy),
+		secp256k1.fromAffine(v.x, v.y),
+	}
+	x, _ := secp256k1.toAffine(secp256k1.multiScalarMult(points, []*big.Int{u1, u2}))
+	if x.Sign() == 0 {
+		return false
+	}
+
+	return x.Mod(x, N).Cmp(r) == 0
+}
+
+//解析 secp256k1 的 SEC1 压缩公钥
+func unmarshalSecp256k1(data []byte) (*big.Int, *big.Int) {
+	if len(data) != compressedPubKeyLen || (data[0] != 0x02 && data[0] != 0x03) {
+		return nil, nil
+	}
+
+	x := new(big.Int).SetBytes(data[1:])
+	y, err := secp256k1.liftX(x)
+	if err != nil {
+		return nil, nil
+	}
+	if y.Bit(0) != uint(data[0]&1) {
+		y.Sub(secp256k1.params.P, y)
+	}
+
+	return x, y
+}
+
+//BIP340 Schnorr 签名
+type schnorrSigner struct {
+	private *ecdsa.PrivateKey
+}
+
+func (s *schnorrSigner) KeyType() KeyType {
+	return KeyTypeSchnorr
+}
+
+func (s *schnorrSigner) PublicKey() []byte {
+	return encodeTypedPublicKey(KeyTypeSchnorr, s.private.PublicKey)
+}
+
+func (s *schnorrSigner) Sign(hash []byte) []byte {
+	return schnorrSign(s.private.D, hash)
+}
+
+type schnorrVerifier struct {
+	pubKey []byte
+}
+
+func (v *schnorrVerifier) KeyType() KeyType {
+	return KeyTypeSchnorr
+}
+
+func (v *schnorrVerifier) Verify(hash, signature []byte) bool {
+	return schnorrVerify(v.pubKey, hash, signature)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//配置文件使用 TOML 的一个子集：
+//  # 注释
+//  key = "字符串"、整数、true/false 或字符串数组 ["a", "b"]
+//  [section] 之后的 key 保存为 section.key
+//每个值都记录所在的行号，出错时指出是哪一行
+type tomlValue struct {
+	Value interface{}
+	Line  int
+}
+
+func parseTOML(r io.Reader) (map[string]tomlValue, error) {
+	values := make(map[string]tomlValue)
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated section header", lineNo)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if !isTOMLKey(section) {
+				return nil, fmt.Errorf("line %d: invalid section name %q", lineNo, section)
+			}
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key := strings.TrimSpace(line[:eq])
+		if !isTOMLKey(key) {
+			return nil, fmt.Errorf("line %d: invalid key %q", lineNo, key)
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", lineNo, key)
+		}
+
+		value, err := parseTOMLValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		values[key] = tomlValue{value, lineNo}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+//去掉行尾的注释，字符串中的 # 不是注释
+func stripTOMLComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && inString:
+			i++
+		case line[i] == '"':
+			inString = !inString
+		case line[i] == '#' && !inString:
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+func isTOMLKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseTOMLValue(s string) (interface{}, error) {
+	switch {
+	case s == "":
+		return nil, errors.New("missing value")
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case strings.HasPrefix(s, "\""):
+		str, rest, err := parseTOMLString(s)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected %q after string", rest)
+		}
+		return str, nil
+	case strings.HasPrefix(s, "["):
+		return parseTOMLArray(s)
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q, strings must be quoted", s)
+	}
+
+	return n, nil
+}
+
+//解析开头的带引号的字符串，返回字符串和剩下的部分
+func parseTOMLString(s string) (string, string, error) {
+	if !strings.HasPrefix(s, "\"") {
+		return "", "", errors.New("expected a string")
+	}
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			str, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return str, s[i+1:], nil
+		}
+	}
+
+	return "", "", errors.New("unterminated string")
+}
+
+//字符串数组，允许最后一个元素后面有逗号
+func parseTOMLArray(s string) ([]string, error) {
+	items := []string{}
+	rest := strings.TrimSpace(s[1:])
+
+	for {
+		if strings.HasPrefix(rest, "]") {
+			if strings.TrimSpace(rest[1:]) != "" {
+				return nil, fmt.Errorf("unexpected %q after array", rest[1:])
+			}
+			return items, nil
+		}
+
+		item, after, err := parseTOMLString(rest)
+		if err != nil {
+			return nil, fmt.Errorf("arrays may only contain strings: %s", err)
+		}
+		items = append(items, item)
+
+		rest = strings.TrimSpace(after)
+		switch {
+		case strings.HasPrefix(rest, ","):
+			rest = strings.TrimSpace(rest[1:])
+		case !strings.HasPrefix(rest, "]"):
+			return nil, errors.New("expected , or ] in array")
+		}
+	}
+}
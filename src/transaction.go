@@ -2,21 +2,16 @@ package main
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
-	"math/big"
 	"strings"
 )
 
-//挖出新块的奖励
-const subsidy = 10
-
 //对于每一笔交易来说，它的输入都会引用之前一笔交易的输出（除了最开始的Coinbase）
 //即，将之前一笔交易的输出作为本交易的输入
 type Transaction struct {
@@ -44,12 +39,20 @@ func (tx Transaction) Serialize() []byte {
 	return encoded.Bytes()
 }
 
-//生成一个交易的Hash
+//生成一个交易的Hash，也就是交易的 ID
+//哈希不包含签名和花费输入的公钥，它们在 ID 确定之后才被填入（部分签名交易由不同的钱包分别填入）
+//coinbase 输入的 PubKey 是任意数据而不是公钥，仍然计入哈希，使得不同的 coinbase 有不同的 ID
 func (tx *Transaction) Hash() []byte {
 	var hash [32]byte
 
 	txCopy := *tx
 	txCopy.ID = []byte{}
+	if !tx.IsCoinbase() {
+		txCopy.Vin = nil
+		for _, vin := range tx.Vin {
+			txCopy.Vin = append(txCopy.Vin, TXInput{vin.Txid, vin.Vout, nil, nil})
+		}
+	}
 
 	hash = sha256.Sum256(txCopy.Serialize())
 
@@ -65,7 +68,7 @@ func (tx *Transaction) Hash() []byte {
 2.存储在新的锁定输出里面的公钥哈希。它识别了一笔交易的“接收方”
 3.新的输出值
 */
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
+func (tx *Transaction) Sign(signer Signer, prevTXs map[string]Transaction) {
 	//coinbase 交易因为没有实际输入，所以没有被签名
 	if tx.IsCoinbase() {
 		return
@@ -77,31 +80,32 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transac
 		}
 	}
 
-	//将会被签署的是修剪后的交易副本，而不是一个完整交易
-	txCopy := tx.TrimmedCopy()
-
-	//
-	for inID, vin := range txCopy.Vin {
+	for inID, vin := range tx.Vin {
 		//迭代prevTXs中的交易
 		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		//Hash 方法对交易进行序列化，并使用 SHA-256 算法进行哈希。哈希后的结果就是我们要签名的数据。
-		txCopy.Vin[inID].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
+		tx.SignInput(inID, signer, prevTx.Vout[vin.Vout].PubKeyHash)
+	}
+}
 
-		dataToSign := fmt.Sprintf("%x\n", txCopy)
+//对第 inID 个输入进行签名，prevPubKeyHash 是该输入所花费的输出中的公钥哈希
+//签名只需要被花费的输出，不需要访问区块链，因此也可以在离线的机器上完成
+//签名算法由签名者决定，ECDSA 签名是按固定宽度连接起来的一对数字，Schnorr 签名是 R.x || s
+func (tx *Transaction) SignInput(inID int, signer Signer, prevPubKeyHash []byte) {
+	dataToSign := tx.signatureData(inID, prevPubKeyHash)
 
-		//我们通过 privKey 对 txCopy.ID 进行签名。
-		//一个 ECDSA 签名就是一对数字，我们对这对数字连接起来，并存储在输入的 Signature 字段。
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, []byte(dataToSign))
-		if err != nil {
-			log.Panic(err)
-		}
-		signature := append(r.Bytes(), s.Bytes()...)
+	tx.Vin[inID].Signature = signer.Sign(dataToSign)
+}
 
-		//在获取完哈希，我们应该重置 PubKey 字段，以便于它不会影响后面的迭代。
-		tx.Vin[inID].Signature = signature
-		txCopy.Vin[inID].PubKey = nil
-	}
+//第 inID 个输入需要签名的数据
+//将会被签署的是修剪后的交易副本，而不是一个完整交易，其中只有这个输入的 PubKey 被设置为所花费输出的公钥哈希
+//ECDSA 只会使用消息的前 32 个字节，所以必须先对副本做 SHA-256，签名才能覆盖所有输入和输出
+func (tx *Transaction) signatureData(inID int, prevPubKeyHash []byte) []byte {
+	txCopy := tx.TrimmedCopy()
+	txCopy.Vin[inID].PubKey = prevPubKeyHash
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%x\n", txCopy)))
+
+	return hash[:]
 }
 
 func (tx Transaction) String() string {
@@ -118,7 +122,7 @@ func (tx Transaction) String() string {
 
 	for i, output := range tx.Vout {
 		lines = append(lines, fmt.Sprintf("     Output %d:", i))
-		lines = append(lines, fmt.Sprintf("       Value:  %d", output.Value))
+		lines = append(lines, fmt.Sprintf("       Value:  %s", output.Value))
 		lines = append(lines, fmt.Sprintf("       Script: %x", output.PubKeyHash))
 	}
 
@@ -156,42 +160,31 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 		}
 	}
 
-	//同一笔交易的副本
-	txCopy := tx.TrimmedCopy()
-	//相同的区块用于生成密钥对
-	curve := elliptic.P256()
-
 	for inID, vin := range tx.Vin {
 		prevTX := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTX.Vout[vin.Vout].PubKeyHash
-
-		////解包存储在 TXInput.Signature 和 TXInput.PubKey 中的值
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(vin.Signature)
-		r.SetBytes(vin.Signature[:(sigLen / 2)])
-		s.SetBytes(vin.Signature[(sigLen / 2):])
-
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(vin.PubKey)
-		x.SetBytes(vin.PubKey[:(keyLen / 2)])
-		y.SetBytes(vin.PubKey[(keyLen / 2):])
-
-		dataToVerify := fmt.Sprintf("%x\n", txCopy)
-
-		//使用从输入提取的公钥创建了一个 ecdsa.PublicKey，通过传入输入中提取的签名执行了 ecdsa.Verify
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-		if ecdsa.Verify(&rawPubKey, []byte(dataToVerify), &r, &s) == false {
+		if !tx.VerifyInput(inID, prevTX.Vout[vin.Vout].PubKeyHash) {
 			return false
 		}
-		txCopy.Vin[inID].PubKey = nil
 	}
 
 	return true
 }
 
+//验证第 inID 个输入的签名，prevPubKeyHash 是该输入所花费的输出中的公钥哈希
+func (tx *Transaction) VerifyInput(inID int, prevPubKeyHash []byte) bool {
+	vin := tx.Vin[inID]
+
+	//严格地解包存储在 TXInput.PubKey 中的公钥，由公钥的类型标记决定签名算法
+	verifier, err := ParseVerifier(vin.PubKey)
+	if err != nil {
+		return false
+	}
+
+	dataToVerify := tx.signatureData(inID, prevPubKeyHash)
+
+	return verifier.Verify(dataToVerify, vin.Signature)
+}
+
 //当矿工挖出一个新的块时，会向新的块中添加一个coinbase交易
 //coinbase交易不需要引用之前一笔交易的输出
 func NewCoinbaseTX(to, data string) *Transaction {
@@ -206,67 +199,107 @@ func NewCoinbaseTX(to, data string) *Transaction {
 	}
 
 	txin := TXInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTXOutput(subsidy, to)
+	txout := NewTXOutput(activeNetParams.Subsidy, to)
 	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}}
 	tx.ID = tx.Hash()
 
 	return &tx
 }
 
-//新建一个UTXO交易
-func NewUTXOTransaction(wallet *Wallet, to string, amount int, UTXOSet *UTXOSet) *Transaction {
+//新建一个UTXO交易，使用 selector 选择输入，返回交易和它的手续费
+func NewUTXOTransaction(wallet *Wallet, to string, amount Amount, selector CoinSelector, UTXOSet *UTXOSet) (*Transaction, Amount, error) {
+	return NewMultiRecipientTransaction(wallet, []Recipient{{to, amount}}, selector, UTXOSet)
+}
+
+//新建一笔向多个收款方付款的UTXO交易，每个收款方对应一个输出，最多再加上一个找零输出
+//返回交易和它的手续费
+func NewMultiRecipientTransaction(wallet *Wallet, recipients []Recipient, selector CoinSelector, UTXOSet *UTXOSet) (*Transaction, Amount, error) {
+	from := fmt.Sprintf("%s", wallet.GetAddress())
+	tx, selection, err := NewUnsignedTransaction(from, recipients, selector, UTXOSet)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for inID := range tx.Vin {
+		tx.Vin[inID].PubKey = wallet.PublicKey
+	}
+	tx.ID = tx.Hash()
+	//对该新生成的交易进行数字签名
+	UTXOSet.Blockchain.SignTransaction(tx, wallet.Signer())
+
+	return tx, selection.Fee, nil
+}
+
+//新建一笔尚未签名的交易，从 from 地址的UTXO中选择输入，找零也回到 from
+//输入中的签名和公钥都为空，需要由持有私钥的钱包补全，因此创建交易的节点不需要知道私钥
+//余额不足等错误被返回，运行中的节点通过 RPC 构造交易时不能因此退出
+func NewUnsignedTransaction(from string, recipients []Recipient, selector CoinSelector, UTXOSet *UTXOSet) (*Transaction, CoinSelection, error) {
 	var inputs []TXInput
 	var outputs []TXOutput
 
-	//对公钥加密（一次sha256，一次RIPEMD-160）
-	pubKeyHash := HashPubKey(wallet.PublicKey)
-	//在UTXO集中找到满足此公钥的UTXO
-	acc, validOutputs := UTXOSet.FindSpendableOutput(pubKeyHash, amount)
-
-	if acc < amount {
-		log.Panic("ERROR: Not enough funds")
+	if len(recipients) == 0 {
+		return nil, CoinSelection{}, errors.New("No recipients.")
 	}
 
-	//遍历UTXO集中选出的UTXO
-	for txid, outs := range validOutputs {
-		//将string类型转换成[]byte
-		txID, err := hex.DecodeString(txid)
-		if err != nil {
-			log.Panic(err)
+	amount := Amount(0)
+	for _, recipient := range recipients {
+		if recipient.Amount <= 0 {
+			return nil, CoinSelection{}, errors.New("Amount must be positive.")
 		}
-
-		//遍历UTXO集中选出的UTXO，并借此生成TXInput
-		for _, out := range outs {
-			input := TXInput{txID, out, nil, wallet.PublicKey}
-			inputs = append(inputs, input)
+		amount += recipient.Amount
+		if !MoneyRange(amount) {
+			return nil, CoinSelection{}, errors.New("Total amount is out of range.")
 		}
 	}
 
-	from := fmt.Sprintf("%s", wallet.GetAddress())
-	outputs = append(outputs, *NewTXOutput(amount, to))
-	//如果选出的UTXO中余额总值大于所需，则多生成一个新的TXOutput
-	if acc > amount {
-		outputs = append(outputs, *NewTXOutput(acc-amount, from))
+	//对地址进行解码获得公钥哈希
+	pubKeyHash, err := DecodeAddress(from)
+	if err != nil {
+		return nil, CoinSelection{}, err
+	}
+	//在UTXO集中按照选币策略选出满足此公钥的UTXO
+	selection, err := UTXOSet.SelectCoins(pubKeyHash, amount, len(recipients), selector)
+	if err != nil {
+		return nil, CoinSelection{}, err
+	}
+
+	//遍历UTXO集中选出的UTXO，并借此生成TXInput
+	for _, utxo := range selection.Inputs {
+		input := TXInput{utxo.Txid, utxo.Vout, nil, nil}
+		inputs = append(inputs, input)
+	}
+
+	for _, recipient := range recipients {
+		outputs = append(outputs, *NewTXOutput(recipient.Amount, recipient.Address))
+	}
+	//如果选出的UTXO在扣除手续费后还有剩余，则多生成一个找零的TXOutput
+	if selection.Change > 0 {
+		outputs = append(outputs, *NewTXOutput(selection.Change, from))
 	}
 
 	//生成交易
 	tx := Transaction{nil, inputs, outputs}
 	tx.ID = tx.Hash()
-	//对该新生成的交易进行数字签名
-	UTXOSet.Blockchain.SignTransaction(&tx, wallet.PrivateKey)
 
-	return &tx
+	return &tx, selection, nil
 }
 
 //将[]byte类型转换成Transaction
 func DeserializeTransaction(data []byte) Transaction {
-	var transaction Transaction
-
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	err := decoder.Decode(&transaction)
+	transaction, err := ParseTransaction(data)
 	if err != nil {
 		log.Panic(err)
 	}
 
 	return transaction
 }
+
+//解析其他节点发来的交易，格式错误时返回错误
+func ParseTransaction(data []byte) (Transaction, error) {
+	var transaction Transaction
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&transaction)
+
+	return transaction, err
+}
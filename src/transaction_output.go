@@ -7,15 +7,17 @@ import (
 )
 
 type TXOutput struct {
-	Value      int
+	Value      Amount
 	PubKeyHash []byte
 }
 
 //简单的锁定一个账户
-//将地址解码，从中提取出公钥哈希并保存在 PubKeyHash 字段
+//将地址解码，从中提取出公钥哈希并保存在 PubKeyHash 字段，Base58Check 和 Bech32 地址都可以
 func (out *TXOutput) Lock(address []byte) {
-	pubKeyHash := Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
+	pubKeyHash, err := DecodeAddress(string(address))
+	if err != nil {
+		log.Panic(err)
+	}
 	out.PubKeyHash = pubKeyHash
 }
 
@@ -25,15 +27,26 @@ func (out *TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
 	return bytes.Compare(out.PubKeyHash, pubKeyHash) == 0
 }
 
-func NewTXOutput(value int, address string) *TXOutput {
+func NewTXOutput(value Amount, address string) *TXOutput {
 	txo := &TXOutput{value, nil}
 	txo.Lock([]byte(address))
 
 	return txo
 }
 
+//UTXO集中的一条记录：一笔交易中尚未花费的输出
+//Outputs 以输出在原交易中的索引为键，这样部分输出被花费后剩下输出的索引仍然不变
+//Height 记录该交易所在区块的高度，Coinbase 标记它是否是挖矿奖励交易
 type TXOutputs struct {
-	Outputs []TXOutput
+	Outputs  map[int]TXOutput
+	Height   int
+	Coinbase bool
+}
+
+//判断这些输出在高度为 spendHeight 的区块中是否可以被花费
+//coinbase 输出必须经过当前网络 CoinbaseMaturity 个区块的确认才能花费，防止分叉后奖励消失导致的花费失效
+func (outs TXOutputs) IsMature(spendHeight int) bool {
+	return !outs.Coinbase || spendHeight-outs.Height >= activeNetParams.CoinbaseMaturity
 }
 
 func (outs TXOutputs) Serialize() []byte {
@@ -49,13 +62,20 @@ func (outs TXOutputs) Serialize() []byte {
 }
 
 func DeserializeOutputs(data []byte) TXOutputs {
-	var outputs TXOutputs
-
-	dec := gob.NewDecoder(bytes.NewReader(data))
-	err := dec.Decode(&outputs)
+	outputs, err := ParseOutputs(data)
 	if err != nil {
 		log.Panic(err)
 	}
 
 	return outputs
 }
+
+//解码 UTXO 集中的一条记录，旧版本的记录中 Outputs 是切片，解码时返回错误
+func ParseOutputs(data []byte) (TXOutputs, error) {
+	var outputs TXOutputs
+
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&outputs)
+
+	return outputs, err
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"github.com/boltdb/bolt"
 	"log"
+	"sort"
 )
 
 const utxoBucket = "chainstate"
@@ -14,28 +15,35 @@ type UTXOSet struct {
 	Blockchain *Blockchain
 }
 
-//迭代找到可以使用的UTXO
-//找到有所需数量的输出
-//对所有未花费交易进行迭代，并对它的值进行累加，当累加值超过我们想要的值时，返回。
-func (u UTXOSet) FindSpendableOutput(pubkeyHash []byte, amount int) (int, map[string][]int) {
-	unspentOutputs := make(map[string][]int)
-	accumulated := 0
+//找到特定公钥可以花费的所有UTXO，尚未成熟的 coinbase 输出不会被选中
+func (u UTXOSet) FindSpendableOutputs(pubkeyHash []byte) []SpendableOutput {
+	var unspentOutputs []SpendableOutput
 	db := u.Blockchain.db
+	spendHeight := u.Blockchain.GetBestHeight() + 1
 
 	err := db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(utxoBucket))
 		c := b.Cursor()
 
 		for k, v := c.First(); k != nil; k, v = c.Next() {
-			//将[]byte类型转换成string
-			txID := hex.EncodeToString(k)
 			outs := DeserializeOutputs(v)
+			if !outs.IsMature(spendHeight) {
+				continue
+			}
+
+			//按输出索引的顺序迭代寻找满足特定公钥的UTXO
+			var indexes []int
+			for outIdx := range outs.Outputs {
+				indexes = append(indexes, outIdx)
+			}
+			sort.Ints(indexes)
 
-			//迭代寻找满足特定公钥的UTXO
-			for outIdx, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubkeyHash) && accumulated < amount {
-					accumulated += out.Value
-					unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
+			for _, outIdx := range indexes {
+				out := outs.Outputs[outIdx]
+				if out.IsLockedWithKey(pubkeyHash) {
+					//bolt 返回的键只在事务内有效，需要复制一份
+					txID := append([]byte{}, k...)
+					unspentOutputs = append(unspentOutputs, SpendableOutput{txID, outIdx, out})
 				}
 			}
 		}
@@ -46,7 +54,15 @@ func (u UTXOSet) FindSpendableOutput(pubkeyHash []byte, amount int) (int, map[st
 		log.Panic(err)
 	}
 
-	return accumulated, unspentOutputs
+	return unspentOutputs
+}
+
+//按照选币策略，从特定公钥的UTXO中选出足够支付 amount 和手续费的输入
+//numOutputs 是交易中除找零之外的输出个数
+func (u UTXOSet) SelectCoins(pubkeyHash []byte, amount Amount, numOutputs int, selector CoinSelector) (CoinSelection, error) {
+	utxos := u.FindSpendableOutputs(pubkeyHash)
+
+	return selector(utxos, amount, numOutputs)
 }
 
 //迭代找到所有未花费输出
@@ -79,6 +95,66 @@ func (u UTXOSet) FindUTXO(pubkeyHash []byte) []TXOutput {
 	return UTXOs
 }
 
+//统计特定公钥的余额，分为可花费的部分和尚未成熟的 coinbase 部分
+func (u UTXOSet) FindBalance(pubkeyHash []byte) (Amount, Amount) {
+	spendable := Amount(0)
+	immature := Amount(0)
+	db := u.Blockchain.db
+	spendHeight := u.Blockchain.GetBestHeight() + 1
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			outs := DeserializeOutputs(v)
+			mature := outs.IsMature(spendHeight)
+
+			for _, out := range outs.Outputs {
+				if !out.IsLockedWithKey(pubkeyHash) {
+					continue
+				}
+				if mature {
+					spendable += out.Value
+				} else {
+					immature += out.Value
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return spendable, immature
+}
+
+//根据交易ID取出UTXO集中该交易尚未花费的输出
+func (u UTXOSet) FindOutputs(txID []byte) (TXOutputs, bool) {
+	var outs TXOutputs
+	found := false
+	db := u.Blockchain.db
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		outsBytes := b.Get(txID)
+
+		if outsBytes != nil {
+			outs = DeserializeOutputs(outsBytes)
+			found = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return outs, found
+}
+
 //统计UTXO集中的交易数量
 func (u UTXOSet) CountTransactions() int {
 	db := u.Blockchain.db
@@ -101,6 +177,33 @@ func (u UTXOSet) CountTransactions() int {
 	return counter
 }
 
+//旧版本的 UTXO 集没有区块高度和 coinbase 标记，部分花费后输出的索引也变了，只能从区块重新建立
+//所有记录都由同一个版本写入，检查第一条记录就够了
+func (u UTXOSet) NeedsReindex() bool {
+	needsReindex := false
+	db := u.Blockchain.db
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return nil
+		}
+
+		_, v := b.Cursor().First()
+		if v != nil {
+			_, err := ParseOutputs(v)
+			needsReindex = err != nil
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return needsReindex
+}
+
 //使用 UTXO 找到未花费输出，然后在数据库中进行存储。这里就是缓存的地方
 func (u UTXOSet) Reindex() {
 	db := u.Blockchain.db
@@ -149,22 +252,16 @@ func (u UTXOSet) Reindex() {
 func (u UTXOSet) Update(block *Block) {
 	db := u.Blockchain.db
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(utxoBucket))
 
 		for _, tx := range block.Transactions {
 			if tx.IsCoinbase() == false {
 				for _, vin := range tx.Vin {
-					updateOuts := TXOutputs{}
 					//Get返回的都是[]byte类型，所以都需要DeserializeOutputs成为Outputs类型
 					outsBytes := b.Get(vin.Txid)
-					outs := DeserializeOutputs(outsBytes)
-
-					for outIdx, out := range outs.Outputs {
-						if outIdx != vin.Vout {
-							updateOuts.Outputs = append(updateOuts.Outputs, out)
-						}
-					}
+					updateOuts := DeserializeOutputs(outsBytes)
+					delete(updateOuts.Outputs, vin.Vout)
 
 					//如果一笔交易的输出被移除，并且不再包含任何输出，那么这笔交易也应该被移除
 					if len(updateOuts.Outputs) == 0 {
@@ -181,9 +278,10 @@ func (u UTXOSet) Update(block *Block) {
 				}
 			}
 
-			newOutputs := TXOutputs{}
-			for _, out := range tx.Vout {
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
+			//记录新输出所在的区块高度，用于 coinbase 的成熟度检查
+			newOutputs := TXOutputs{make(map[int]TXOutput), block.Height, tx.IsCoinbase()}
+			for outIdx, out := range tx.Vout {
+				newOutputs.Outputs[outIdx] = out
 			}
 
 			err := b.Put(tx.ID, newOutputs.Serialize())
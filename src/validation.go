@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+//共识规则中与上下文无关的交易检查：
+//1.输入和输出都不能为空
+//2.每个输出的金额和输出总额都必须在 0 到 MaxMoney 之间，这同时保证了累加时不会溢出
+//3.同一笔交易中不能重复引用同一个输出
+//4.交易的 ID 必须是交易的哈希，否则可以用别人的 ID 覆盖 UTXO 集和内存池中的记录
+func CheckTransaction(tx *Transaction) error {
+	if !bytes.Equal(tx.ID, tx.Hash()) {
+		return errors.New("Transaction ID does not match its hash.")
+	}
+	if len(tx.Vin) == 0 {
+		return errors.New("Transaction has no inputs.")
+	}
+	if len(tx.Vout) == 0 {
+		return errors.New("Transaction has no outputs.")
+	}
+
+	valueOut := Amount(0)
+	for _, out := range tx.Vout {
+		if out.Value < 0 {
+			return errors.New("Transaction has a negative output value.")
+		}
+		if out.Value > MaxMoney {
+			return errors.New("Transaction output value is too large.")
+		}
+		valueOut += out.Value
+		if !MoneyRange(valueOut) {
+			return errors.New("Transaction total output value is out of range.")
+		}
+	}
+
+	//coinbase 交易没有真正的输入
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	spent := make(map[string]bool)
+	for _, vin := range tx.Vin {
+		if len(vin.Txid) == 0 || vin.Vout < 0 {
+			return errors.New("Transaction references a null output.")
+		}
+
+		outpoint := fmt.Sprintf("%x:%d", vin.Txid, vin.Vout)
+		if spent[outpoint] {
+			return fmt.Errorf("Transaction spends %s more than once.", outpoint)
+		}
+		spent[outpoint] = true
+	}
+
+	return nil
+}
+
+//对照UTXO集检查交易的输入，spendHeight 是交易将被打包进的区块高度
+//每个输入引用的输出必须存在且未被花费、已经成熟、并且属于输入提供的公钥
+//输出总额不能超过输入总额，返回值是两者之差，即交易的手续费
+func CheckTxInputs(tx *Transaction, UTXOSet UTXOSet, spendHeight int) (Amount, error) {
+	valueIn := Amount(0)
+
+	for _, vin := range tx.Vin {
+		outs, ok := UTXOSet.FindOutputs(vin.Txid)
+		out, exists := outs.Outputs[vin.Vout]
+		if !ok || !exists {
+			return 0, fmt.Errorf("Input %x:%d is missing or already spent.", vin.Txid, vin.Vout)
+		}
+
+		if !outs.IsMature(spendHeight) {
+			return 0, fmt.Errorf("Input %x:%d spends an immature coinbase.", vin.Txid, vin.Vout)
+		}
+
+		if !vin.UsesKey(out.PubKeyHash) {
+			return 0, fmt.Errorf("Input %x:%d is not locked with the provided key.", vin.Txid, vin.Vout)
+		}
+
+		valueIn += out.Value
+		if !MoneyRange(out.Value) || !MoneyRange(valueIn) {
+			return 0, errors.New("Transaction input value is out of range.")
+		}
+	}
+
+	valueOut := Amount(0)
+	for _, out := range tx.Vout {
+		valueOut += out.Value
+	}
+
+	if valueIn < valueOut {
+		return 0, fmt.Errorf("Transaction spends %s but its inputs only hold %s.", valueOut, valueIn)
+	}
+
+	return valueIn - valueOut, nil
+}
+
+//验证交易中每个输入的签名，输入引用的输出必须已经由 CheckTxInputs 检查过
+//batch 不为空时 Schnorr 签名只加入 batch，由调用者在最后一起验证，其他签名立即验证
+func verifyTxSignatures(tx *Transaction, UTXOSet UTXOSet, batch *SchnorrBatch) error {
+	for inID, vin := range tx.Vin {
+		outs, _ := UTXOSet.FindOutputs(vin.Txid)
+		prevPubKeyHash := outs.Outputs[vin.Vout].PubKeyHash
+
+		verifier, err := ParseVerifier(vin.PubKey)
+		if err != nil {
+			return fmt.Errorf("Input %d: %s", inID, err)
+		}
+
+		hash := tx.signatureData(inID, prevPubKeyHash)
+		if schnorr, ok := verifier.(*schnorrVerifier); ok && batch != nil {
+			batch.Add(schnorr.pubKey, hash, vin.Signature)
+			continue
+		}
+		if !verifier.Verify(hash, vin.Signature) {
+			return fmt.Errorf("Input %d has an invalid signature.", inID)
+		}
+	}
+
+	return nil
+}
+
+//检查将被打包进高度为 height 的区块中的交易集
+//除了每笔交易自身的检查外，区块中只能有一笔 coinbase 交易，不同交易之间不能花费同一个输出，
+//交易 ID 不能重复，也不能是 UTXO 集中已有未花费输出的 ID，
+//coinbase 的输出总额不能超过挖矿奖励加上所有交易的手续费
+//区块中所有的 Schnorr 签名最后一起批量验证
+func CheckBlockTransactions(txs []*Transaction, UTXOSet UTXOSet, height int) error {
+	var coinbase *Transaction
+	var batch SchnorrBatch
+	fees := Amount(0)
+	spent := make(map[string]bool)
+	seen := make(map[string]bool)
+
+	for _, tx := range txs {
+		err := CheckTransaction(tx)
+		if err != nil {
+			return fmt.Errorf("Transaction %x: %s", tx.ID, err)
+		}
+
+		//UTXO 集以交易 ID 为键，ID 已经有未花费输出的交易会覆盖它们（BIP30）
+		txID := hex.EncodeToString(tx.ID)
+		if seen[txID] {
+			return fmt.Errorf("Transaction %x appears twice in the block.", tx.ID)
+		}
+		seen[txID] = true
+		if _, ok := UTXOSet.FindOutputs(tx.ID); ok {
+			return fmt.Errorf("Transaction %x would overwrite unspent outputs.", tx.ID)
+		}
+
+		if tx.IsCoinbase() {
+			if coinbase != nil {
+				return errors.New("Block has more than one coinbase transaction.")
+			}
+			coinbase = tx
+			continue
+		}
+
+		for _, vin := range tx.Vin {
+			outpoint := fmt.Sprintf("%x:%d", vin.Txid, vin.Vout)
+			if spent[outpoint] {
+				return fmt.Errorf("Output %s is spent twice in the block.", outpoint)
+			}
+			spent[outpoint] = true
+		}
+
+		fee, err := CheckTxInputs(tx, UTXOSet, height)
+		if err != nil {
+			return fmt.Errorf("Transaction %x: %s", tx.ID, err)
+		}
+		err = verifyTxSignatures(tx, UTXOSet, &batch)
+		if err != nil {
+			return fmt.Errorf("Transaction %x: %s", tx.ID, err)
+		}
+		fees += fee
+	}
+
+	if batch.Len() > 0 && !batch.Verify() {
+		return errors.New("Block has an invalid Schnorr signature.")
+	}
+
+	if coinbase == nil {
+		return errors.New("Block has no coinbase transaction.")
+	}
+
+	reward := Amount(0)
+	for _, out := range coinbase.Vout {
+		reward += out.Value
+	}
+	subsidy := activeNetParams.Subsidy
+	if reward > subsidy+fees {
+		return fmt.Errorf("Coinbase pays %s, more than subsidy and fees %s.", reward, subsidy+fees)
+	}
+
+	return nil
+}
+
+//与本节点的区块链无关的区块检查：至少有一笔交易，哈希与块的内容一致并满足工作量证明，每笔交易都通过 CheckTransaction
+//没有交易的块无法计算 Merkle 树，必须在计算哈希之前拒绝
+//不通过说明块本身是无效的，与本节点的状态无关
+func CheckBlockSanity(block *Block) error {
+	if len(block.Transactions) == 0 {
+		return errors.New("Block has no transactions.")
+	}
+
+	pow := NewProofOfWork(block)
+	if !bytes.Equal(pow.Hash(), block.Hash) {
+		return errors.New("Block hash does not match its content.")
+	}
+	if !pow.Validate() {
+		return errors.New("Block has an invalid proof of work.")
+	}
+
+	for _, tx := range block.Transactions {
+		err := CheckTransaction(tx)
+		if err != nil {
+			return fmt.Errorf("Transaction %x: %s", tx.ID, err)
+		}
+	}
+
+	return nil
+}
+
+//检查一个接在当前链尾的新区块：通过 CheckBlockSanity，高度是父块的高度加一，
+//并且其中的交易在本节点的 UTXO 集上都符合共识规则
+func CheckBlock(block *Block, UTXOSet UTXOSet) error {
+	err := CheckBlockSanity(block)
+	if err != nil {
+		return err
+	}
+
+	parent, err := UTXOSet.Blockchain.GetBlock(block.PrevBlockHash)
+	if err != nil {
+		return errors.New("Block has an unknown parent.")
+	}
+	if block.Height != parent.Height+1 {
+		return fmt.Errorf("Block height %d does not follow the parent height %d.", block.Height, parent.Height)
+	}
+
+	return CheckBlockTransactions(block.Transactions, UTXOSet, block.Height)
+}
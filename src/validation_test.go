@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"github.com/boltdb/bolt"
+	"strings"
+	"testing"
+)
+
+//在临时目录中创建一条 regtest 区块链，创世块的奖励发给返回的钱包
+func newTestBlockchain(t *testing.T) (*Blockchain, *Wallet) {
+	dataDir := activeConfig.DataDir
+	activeConfig.DataDir = t.TempDir()
+	SelectNetwork("regtest")
+
+	wallet := NewWallet()
+	bc := CreateBlockchain(string(wallet.GetAddress()), "test")
+	UTXOSet{bc}.Reindex()
+
+	t.Cleanup(func() {
+		bc.db.Close()
+		activeConfig.DataDir = dataDir
+		SelectNetwork("main")
+	})
+
+	return bc, wallet
+}
+
+func expectError(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected an error containing %q, got %v", want, err)
+	}
+}
+
+func TestCheckTransactionRejectsForgedID(t *testing.T) {
+	victim := NewCoinbaseTX(string(NewWallet().GetAddress()), "victim")
+	forged := NewCoinbaseTX(string(NewWallet().GetAddress()), "forged")
+	if err := CheckTransaction(forged); err != nil {
+		t.Fatal(err)
+	}
+
+	forged.ID = victim.ID
+	expectError(t, CheckTransaction(forged), "ID does not match")
+}
+
+func TestTransactionIDIgnoresSignatures(t *testing.T) {
+	bc, wallet := newTestBlockchain(t)
+	UTXOSet := UTXOSet{bc}
+	generateBlocks(bc, activeNetParams.CoinbaseMaturity, string(NewWallet().GetAddress()))
+
+	tx, _, err := NewUTXOTransaction(wallet, string(NewWallet().GetAddress()), Coin, coinSelectors["largest"], &UTXOSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckBlockTransactionsRejectsExistingID(t *testing.T) {
+	bc, wallet := newTestBlockchain(t)
+	UTXOSet := UTXOSet{bc}
+	height := bc.GetBestHeight() + 1
+
+	//创世块的 coinbase 还没有被花费，同一笔交易不能再次被打包
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := genesis.Transactions[0]
+	expectError(t, CheckBlockTransactions([]*Transaction{coinbase}, UTXOSet, height), "overwrite unspent outputs")
+
+	fresh := NewCoinbaseTX(string(wallet.GetAddress()), "")
+	if err := CheckBlockTransactions([]*Transaction{fresh}, UTXOSet, height); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, CheckBlockTransactions([]*Transaction{fresh, fresh}, UTXOSet, height), "appears twice")
+}
+
+//花费创世块 coinbase 的已签名交易
+func spendGenesisCoinbase(t *testing.T, bc *Blockchain, wallet *Wallet) *Transaction {
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := genesis.Transactions[0]
+
+	tx := Transaction{nil, []TXInput{{coinbase.ID, 0, nil, wallet.PublicKey}}, []TXOutput{*NewTXOutput(Coin, string(NewWallet().GetAddress()))}}
+	tx.ID = tx.Hash()
+	tx.SignInput(0, wallet.Signer(), HashPubKey(wallet.PublicKey))
+
+	return &tx
+}
+
+func TestCoinbaseMaturity(t *testing.T) {
+	bc, wallet := newTestBlockchain(t)
+	tx := spendGenesisCoinbase(t, bc, wallet)
+	maturity := activeNetParams.CoinbaseMaturity
+
+	_, err := CheckTxInputs(tx, UTXOSet{bc}, maturity-1)
+	expectError(t, err, "immature coinbase")
+	if _, err := CheckTxInputs(tx, UTXOSet{bc}, maturity); err != nil {
+		t.Fatal(err)
+	}
+
+	//内存池按下一个区块的高度检查
+	generateBlocks(bc, maturity-2, string(NewWallet().GetAddress()))
+	expectError(t, acceptToMempool(tx, bc), "immature coinbase")
+	generateBlocks(bc, 1, string(NewWallet().GetAddress()))
+	if err := acceptToMempool(tx, bc); err != nil {
+		t.Fatal(err)
+	}
+	removeFromMempool(hex.EncodeToString(tx.ID))
+}
+
+//旧版本的 UTXO 集记录
+type legacyTestOutputs struct {
+	Outputs []TXOutput
+}
+
+func TestNewBlockchainRebuildsLegacyUTXOSet(t *testing.T) {
+	bc, wallet := newTestBlockchain(t)
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := genesis.Transactions[0]
+
+	var legacy bytes.Buffer
+	err = gob.NewEncoder(&legacy).Encode(legacyTestOutputs{coinbase.Vout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(utxoBucket)).Put(coinbase.ID, legacy.Bytes())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(UTXOSet{bc}).NeedsReindex() {
+		t.Fatal("legacy UTXO set is not detected")
+	}
+
+	bc.db.Close()
+	*bc = *NewBlockchain("test")
+
+	outs, ok := UTXOSet{bc}.FindOutputs(coinbase.ID)
+	out := outs.Outputs[0]
+	if !ok || !outs.Coinbase || !out.IsLockedWithKey(HashPubKey(wallet.PublicKey)) {
+		t.Errorf("UTXO set is not rebuilt: %+v", outs)
+	}
+}
+
+func TestCheckTransactionRejections(t *testing.T) {
+	address := string(NewWallet().GetAddress())
+	input := TXInput{[]byte{1, 2, 3}, 0, nil, NewWallet().PublicKey}
+	output := *NewTXOutput(Coin, address)
+
+	tests := []struct {
+		name string
+		vin  []TXInput
+		vout []TXOutput
+		want string
+	}{
+		{"no inputs", nil, []TXOutput{output}, "no inputs"},
+		{"no outputs", []TXInput{input}, nil, "no outputs"},
+		{"negative output", []TXInput{input}, []TXOutput{{-1, output.PubKeyHash}}, "negative output"},
+		{"output above MaxMoney", []TXInput{input}, []TXOutput{{MaxMoney + 1, output.PubKeyHash}}, "too large"},
+		{"total above MaxMoney", []TXInput{input}, []TXOutput{{MaxMoney, output.PubKeyHash}, {1, output.PubKeyHash}}, "out of range"},
+		{"null output", []TXInput{{nil, 0, nil, input.PubKey}}, []TXOutput{output}, "null output"},
+		{"negative index", []TXInput{{input.Txid, -1, nil, input.PubKey}}, []TXOutput{output}, "null output"},
+		{"duplicate input", []TXInput{input, input}, []TXOutput{output}, "more than once"},
+	}
+
+	for _, test := range tests {
+		tx := Transaction{nil, test.vin, test.vout}
+		tx.ID = tx.Hash()
+		err := CheckTransaction(&tx)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.want, err)
+		}
+	}
+
+	tx := Transaction{nil, []TXInput{input}, []TXOutput{{MaxMoney, output.PubKeyHash}}}
+	tx.ID = tx.Hash()
+	if err := CheckTransaction(&tx); err != nil {
+		t.Errorf("output of MaxMoney rejected: %v", err)
+	}
+}
+
+func TestCheckTxInputsRejections(t *testing.T) {
+	bc, wallet := newTestBlockchain(t)
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reward := genesis.Transactions[0].Vout[0].Value
+	height := activeNetParams.CoinbaseMaturity
+
+	tx := spendGenesisCoinbase(t, bc, wallet)
+	fee, err := CheckTxInputs(tx, UTXOSet{bc}, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee != reward-Coin {
+		t.Errorf("fee is %s, expected %s", fee, reward-Coin)
+	}
+
+	overspend := *tx
+	overspend.Vout = []TXOutput{*NewTXOutput(reward+1, string(NewWallet().GetAddress()))}
+	_, err = CheckTxInputs(&overspend, UTXOSet{bc}, height)
+	expectError(t, err, "inputs only hold")
+
+	missing := *tx
+	missing.Vin = []TXInput{{[]byte("missing"), 0, nil, wallet.PublicKey}}
+	_, err = CheckTxInputs(&missing, UTXOSet{bc}, height)
+	expectError(t, err, "missing or already spent")
+
+	wrongIndex := *tx
+	wrongIndex.Vin = []TXInput{{tx.Vin[0].Txid, 1, nil, wallet.PublicKey}}
+	_, err = CheckTxInputs(&wrongIndex, UTXOSet{bc}, height)
+	expectError(t, err, "missing or already spent")
+
+	wrongKey := *tx
+	wrongKey.Vin = []TXInput{{tx.Vin[0].Txid, 0, nil, NewWallet().PublicKey}}
+	_, err = CheckTxInputs(&wrongKey, UTXOSet{bc}, height)
+	expectError(t, err, "not locked with the provided key")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//每隔多久输出一次搜索进度
+const vanityProgressInterval = 2 * time.Second
+
+//当前网络的地址可能的第一个字符，由版本号决定，例如主网的地址总是以 1 开头
+//版本号相同时，地址的第一个字符在公钥哈希全为 0x00 和全为 0xff 的两个地址之间
+func vanityAddressStarts() string {
+	version := []byte{activeNetParams.AddressVersion}
+	payloadLen := pubKeyHashLen + addressChecksumLen
+	first := Base58Encode(append(version, make([]byte, payloadLen)...))[0]
+	last := Base58Encode(append(version, bytes.Repeat([]byte{0xff}, payloadLen)...))[0]
+
+	start := bytes.IndexByte(b58Alphabet, first)
+	end := bytes.IndexByte(b58Alphabet, last)
+
+	return string(b58Alphabet[start : end+1])
+}
+
+//检查靓号前缀：第一个字符必须是当前网络的地址可能的第一个字符，并且只包含 Base58 字符
+func validateVanityPrefix(prefix string) error {
+	starts := vanityAddressStarts()
+	if prefix == "" || strings.IndexByte(starts, prefix[0]) < 0 {
+		return fmt.Errorf("Addresses on %s always start with one of %q.", activeNetParams.Name, starts)
+	}
+
+	for i := 0; i < len(prefix); i++ {
+		if bytes.IndexByte(b58Alphabet, prefix[i]) < 0 {
+			return fmt.Errorf("%q is not a Base58 character.", prefix[i])
+		}
+	}
+
+	return nil
+}
+
+//估算找到前缀平均需要尝试的次数：第一个字符只有几种可能，之后每个字符有 58 种可能
+func vanityDifficulty(prefix string) float64 {
+	starts := float64(len(vanityAddressStarts()))
+
+	return starts * math.Pow(float64(len(b58Alphabet)), float64(len(prefix)-1))
+}
+
+//在 workers 个 goroutine 中并行生成随机私钥，直到地址以 prefix 开头
+//progress 每隔 vanityProgressInterval 被调用一次，参数是已经尝试的次数
+func FindVanityAddress(prefix string, keyType KeyType, workers int, progress func(attempts uint64)) (*Wallet, error) {
+	if err := validateVanityPrefix(prefix); err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		return nil, errors.New("Number of workers must be positive.")
+	}
+
+	var attempts uint64
+	var wg sync.WaitGroup
+	found := make(chan *Wallet, workers)
+	done := make(chan struct{})
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				wallet := NewWalletWithKeyType(keyType)
+				atomic.AddUint64(&attempts, 1)
+				if strings.HasPrefix(string(wallet.GetAddress()), prefix) {
+					found <- wallet
+					return
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(vanityProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case wallet := <-found:
+			close(done)
+			wg.Wait()
+			return wallet, nil
+		case <-ticker.C:
+			if progress != nil {
+				progress(atomic.LoadUint64(&attempts))
+			}
+		}
+	}
+}
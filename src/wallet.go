@@ -6,8 +6,11 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/gob"
+	"errors"
 	"github.com/crypto/ripemd160"
 	"log"
+	"math/big"
 )
 
 //比特币的地址生成算法：
@@ -16,28 +19,50 @@ import (
 //2.椭圆曲线算公钥
 //3.计算公钥的SHA-256哈希值（加前缀0x04）
 //4.计算RIPEMD-160哈希值
-//5.加入地址版本号（比特币主网版本号0x00）
+//5.加入地址版本号（比特币主网版本号0x00，这里由当前网络的 AddressVersion 决定）
 //6.计算Sha-256哈希值（连续两次）
 //7.取上一步结果的前4个字节（8位十六进制）
 //8.把这4个字节加载第五步的结果后面
 //9.用Base58编码变换一下地址
-const version = byte(0x00)
 const addressChecksumLen = 4
 
+//导出私钥的编码方式与地址相同：Base58(PrivKeyVersion + D + checksum)，类似比特币的 WIF
+const privKeyLen = 32
+const compressedKeyFlag = byte(0x01)
+
 //钱包有私钥和公钥，私钥基于椭圆曲线数字签名算法
+//KeyType 是签名算法，旧的钱包都是 P-256 ECDSA
 type Wallet struct {
 	PrivateKey ecdsa.PrivateKey
 	PublicKey  []byte
+	KeyType    KeyType
 }
 
 //创建钱包
 func NewWallet() *Wallet {
 	private, public := newKeyPair()
-	wallet := Wallet{private, public}
+	wallet := Wallet{private, public, KeyTypeP256}
+
+	return &wallet
+}
+
+//创建使用指定签名算法的钱包
+func NewWalletWithKeyType(keyType KeyType) *Wallet {
+	return NewWalletFromKey(generatePrivateKey(keyType), keyType)
+}
+
+//由已有的私钥创建钱包，HD 钱包派生出的私钥使用它
+func NewWalletFromKey(private ecdsa.PrivateKey, keyType KeyType) *Wallet {
+	wallet := Wallet{private, encodeTypedPublicKey(keyType, private.PublicKey), keyType}
 
 	return &wallet
 }
 
+//钱包私钥的签名者
+func (w *Wallet) Signer() Signer {
+	return NewSigner(w.KeyType, &w.PrivateKey)
+}
+
 //将一个公钥转换成一个Base58地址需要以下步骤：
 //1.使用RIPEMD160(SHA256(PubKey))哈希算法，取公钥并对其哈希两次
 //2.给哈希加上地址生成算法版本的前缀
@@ -47,13 +72,18 @@ func NewWallet() *Wallet {
 func (w Wallet) GetAddress() []byte {
 	pubKeyHash := HashPubKey(w.PublicKey)
 
-	versionedPayload := append([]byte{version}, pubKeyHash...)
-	checksum := checksum(versionedPayload)
+	return []byte(encodeBase58Address(pubKeyHash))
+}
 
-	fullPayload := append(versionedPayload, checksum...)
-	address := Base58Encode(fullPayload)
+//同一个公钥哈希的 Bech32 地址，只包含小写字母和数字，抄写错误更容易被发现
+//Schnorr 公钥使用 Bech32m 编码
+func (w Wallet) GetBech32Address() []byte {
+	witnessVersion := byte(witnessVersionECDSA)
+	if w.KeyType == KeyTypeSchnorr {
+		witnessVersion = witnessVersionSchnorr
+	}
 
-	return address
+	return []byte(encodeBech32Address(witnessVersion, HashPubKey(w.PublicKey)))
 }
 
 //对公钥进行Hash
@@ -71,14 +101,75 @@ func HashPubKey(pubKey []byte) []byte {
 	return publicRIPEMD160
 }
 
+//检查 Base58Check 或 Bech32 地址是否有效，需要错误的位置时使用 DecodeAddress
 func ValidateAddress(address string) bool {
-	pubKeyHash := Base58Decode([]byte(address))
-	actualChecksum := pubKeyHash[len(pubKeyHash)-addressChecksumLen:]
-	version := pubKeyHash[0]
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
-	targetChecksum := checksum(append([]byte{version}, pubKeyHash...))
+	_, err := DecodeAddress(address)
+
+	return err == nil
+}
+
+//将钱包的私钥编码成带校验和的Base58字符串，用于在钱包文件之间转移单个私钥
+//与比特币的 WIF 相同，使用压缩公钥的钱包在私钥后面加上 compressedKeyFlag，
+//没有这个标记的私钥使用旧版本的公钥格式，这样导入后的地址与原来的地址相同
+//其他签名算法的私钥在后面加上签名算法的标记
+func EncodePrivateKey(wallet *Wallet) string {
+	payload := append([]byte{activeNetParams.PrivKeyVersion}, wallet.PrivateKey.D.FillBytes(make([]byte, privKeyLen))...)
+	if wallet.KeyType != KeyTypeP256 {
+		payload = append(payload, byte(wallet.KeyType))
+	} else if len(wallet.PublicKey) == compressedPubKeyLen {
+		payload = append(payload, compressedKeyFlag)
+	}
+	payload = append(payload, checksum(payload)...)
+
+	return string(Base58Encode(payload))
+}
+
+//解码 EncodePrivateKey 导出的私钥，检查字符、版本号、长度和校验和
+func DecodePrivateKey(encoded string) (*Wallet, error) {
+	for i := 0; i < len(encoded); i++ {
+		if bytes.IndexByte(b58Alphabet, encoded[i]) < 0 {
+			return nil, errors.New("Private key contains an invalid Base58 character.")
+		}
+	}
+	if len(encoded) == 0 {
+		return nil, errors.New("Private key is empty.")
+	}
+
+	payload := Base58Decode([]byte(encoded))
+	length := len(payload) - addressChecksumLen
+	flagged := length == 1+privKeyLen+1
+	if (length != 1+privKeyLen && !flagged) || payload[0] != activeNetParams.PrivKeyVersion {
+		return nil, errors.New("Private key has an invalid length or version.")
+	}
+
+	keyType := KeyTypeP256
+	if flagged && payload[length-1] != compressedKeyFlag {
+		keyType = KeyType(payload[length-1])
+		if keyType == KeyTypeP256 || !keyType.IsValid() {
+			return nil, errUnknownKeyType
+		}
+	}
+
+	data := payload[:length]
+	if !bytes.Equal(checksum(data), payload[length:]) {
+		return nil, errors.New("Private key checksum does not match.")
+	}
+
+	curve := keyType.Curve()
+	key := data[1 : 1+privKeyLen]
+	private := ecdsa.PrivateKey{}
+	private.D = new(big.Int).SetBytes(key)
+	if private.D.Sign() == 0 || private.D.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("Private key is out of range.")
+	}
+	private.Curve = curve
+	private.X, private.Y = curve.ScalarBaseMult(key)
+
+	if !flagged {
+		return &Wallet{private, encodeLegacyPublicKey(private.PublicKey), KeyTypeP256}, nil
+	}
 
-	return bytes.Compare(actualChecksum, targetChecksum) == 0
+	return NewWalletFromKey(private, keyType), nil
 }
 
 //双重hash之后的校验和
@@ -89,14 +180,82 @@ func checksum(payload []byte) []byte {
 	return secondSHA[:addressChecksumLen]
 }
 
-//在基于椭圆曲线的算法中，公钥是曲线上的点，公钥是X，Y坐标的组合
+//钱包在文件中的格式：私钥只保存标量 D，公钥坐标由它重新计算
+//ecdsa.PrivateKey 中的曲线是接口类型，无法直接用 gob 编码
+type walletData struct {
+	D         []byte
+	PublicKey []byte
+	KeyType   KeyType
+}
+
+//最早的钱包文件直接保存 ecdsa.PrivateKey，公钥是未压缩的 X、Y 坐标
+//解码时忽略曲线字段，旧的钱包都使用 P-256
+type legacyWallet struct {
+	PrivateKey struct {
+		PublicKey struct {
+			X, Y *big.Int
+		}
+		D *big.Int
+	}
+	PublicKey []byte
+}
+
+//转换成现在的钱包，公钥保持原样，这样它的地址不会改变
+func (lw *legacyWallet) wallet() (*Wallet, error) {
+	if lw.PrivateKey.D == nil || lw.PrivateKey.D.Sign() <= 0 {
+		return nil, errors.New("Legacy wallet has no private key.")
+	}
+
+	curve := elliptic.P256()
+	w := &Wallet{PublicKey: lw.PublicKey, KeyType: KeyTypeP256}
+	w.PrivateKey.Curve = curve
+	w.PrivateKey.D = lw.PrivateKey.D
+	w.PrivateKey.X, w.PrivateKey.Y = curve.ScalarBaseMult(lw.PrivateKey.D.Bytes())
+
+	return w, nil
+}
+
+func (w Wallet) GobEncode() ([]byte, error) {
+	var content bytes.Buffer
+
+	encoder := gob.NewEncoder(&content)
+	err := encoder.Encode(walletData{w.PrivateKey.D.Bytes(), w.PublicKey, w.KeyType})
+
+	return content.Bytes(), err
+}
+
+func (w *Wallet) GobDecode(data []byte) error {
+	var stored walletData
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&stored)
+	if err != nil {
+		return err
+	}
+
+	if !stored.KeyType.IsValid() {
+		return errUnknownKeyType
+	}
+
+	curve := stored.KeyType.Curve()
+	w.KeyType = stored.KeyType
+	w.PrivateKey.Curve = curve
+	w.PrivateKey.D = new(big.Int).SetBytes(stored.D)
+	w.PrivateKey.X, w.PrivateKey.Y = curve.ScalarBaseMult(stored.D)
+	//旧的钱包保存的是旧格式的公钥，保持原样，这样它的地址不会改变
+	w.PublicKey = stored.PublicKey
+
+	return nil
+}
+
+//在基于椭圆曲线的算法中，公钥是曲线上的点，公钥是X，Y坐标的组合，保存时使用压缩格式
 func newKeyPair() (ecdsa.PrivateKey, []byte) {
 	curve := elliptic.P256()
 	private, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
 		log.Panic(err)
 	}
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+	pubKey := encodePublicKey(private.PublicKey)
 
 	return *private, pubKey
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"golang.org/x/crypto/scrypt"
+	"log"
+)
+
+//加密钱包文件的开头，用来和旧的明文钱包文件区分
+const walletMagic = "WALLETENC"
+const walletEncryptionVersion = 1
+
+//scrypt 的参数，N=2^15 在普通机器上大约需要 100ms
+const scryptN = 1 << 15
+const scryptR = 8
+const scryptP = 1
+const walletKeyLen = 32
+
+var errWrongPassphrase = errors.New("The wallet passphrase is incorrect.")
+
+//加密后的钱包文件内容
+//密钥由密码经过 scrypt 派生得到，钱包数据使用 AES-256-GCM 加密并认证
+type encryptedWallet struct {
+	Version    int
+	Salt       []byte
+	N          int
+	R          int
+	P          int
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+//判断文件内容是否是加密的钱包
+func isEncryptedWallet(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(walletMagic))
+}
+
+//使用密码加密钱包数据，每次加密都会生成新的盐和随机数
+func encryptWallet(plaintext, passphrase []byte) []byte {
+	salt := make([]byte, 32)
+	_, err := rand.Read(salt)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	aead, err := newWalletCipher(passphrase, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		log.Panic(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	encrypted := encryptedWallet{
+		walletEncryptionVersion,
+		salt,
+		scryptN,
+		scryptR,
+		scryptP,
+		nonce,
+		aead.Seal(nil, nonce, plaintext, []byte(walletMagic)),
+	}
+
+	var content bytes.Buffer
+	content.WriteString(walletMagic)
+	encoder := gob.NewEncoder(&content)
+	err = encoder.Encode(encrypted)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return content.Bytes()
+}
+
+//使用密码解密钱包数据，密码错误或文件被篡改时返回 errWrongPassphrase
+func decryptWallet(data, passphrase []byte) ([]byte, error) {
+	var encrypted encryptedWallet
+
+	decoder := gob.NewDecoder(bytes.NewReader(data[len(walletMagic):]))
+	err := decoder.Decode(&encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	if encrypted.Version != walletEncryptionVersion {
+		return nil, errors.New("Unsupported wallet encryption version.")
+	}
+
+	aead, err := newWalletCipher(passphrase, encrypted.Salt, encrypted.N, encrypted.R, encrypted.P)
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted.Nonce) != aead.NonceSize() {
+		return nil, errors.New("Wallet file is corrupted.")
+	}
+
+	plaintext, err := aead.Open(nil, encrypted.Nonce, encrypted.Ciphertext, []byte(walletMagic))
+	if err != nil {
+		return nil, errWrongPassphrase
+	}
+
+	return plaintext, nil
+}
+
+//由密码派生密钥，并生成 AES-256-GCM 加密器
+func newWalletCipher(passphrase, salt []byte, N, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, N, r, p, walletKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//钱包的文本备份格式，用于备份和在钱包文件之间迁移：
+//每行一条记录，字段之间用空格分开，空行和以 # 开头的行会被忽略
+//  mnemonic WORD...             HD 钱包的助记词
+//  nextindex N                  HD 钱包下一个地址的序号
+//  privkey PRIVKEY ADDRESS      EncodePrivateKey 编码的私钥和它的地址
+//  watchaddress ADDRESS         只观察的地址
+//  watchpubkey PUBKEY ADDRESS   只观察的公钥（十六进制）和它的地址
+//导入时会检查私钥和公钥是否与地址一致
+const walletDumpHeader = "# Wallet dump, keep it secret: it contains unencrypted private keys"
+
+//将钱包写成文本备份格式
+func (ws *Wallets) Dump(w io.Writer) error {
+	lines := []string{
+		walletDumpHeader,
+		fmt.Sprintf("# Created at %s", time.Now().UTC().Format(time.RFC3339)),
+	}
+	if ws.Mnemonic != "" {
+		lines = append(lines, "mnemonic "+ws.Mnemonic)
+		lines = append(lines, fmt.Sprintf("nextindex %d", ws.NextIndex))
+	}
+
+	var keys []string
+	for address, wallet := range ws.Wallets {
+		keys = append(keys, fmt.Sprintf("privkey %s %s", EncodePrivateKey(wallet), address))
+	}
+	for address, entry := range ws.WatchOnly {
+		if len(entry.PubKey) > 0 {
+			keys = append(keys, fmt.Sprintf("watchpubkey %x %s", entry.PubKey, address))
+		} else {
+			keys = append(keys, "watchaddress "+address)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, line := range append(lines, keys...) {
+		_, err := fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//导入文本备份中的记录，已经在钱包中的地址会被跳过，返回新导入的地址个数
+//钱包已经有不同的助记词时不会替换它，备份中的私钥仍然会全部导入
+func (ws *Wallets) Import(r io.Reader) (int, error) {
+	imported := 0
+	var mnemonic string
+	var nextIndex uint32
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		added, err := ws.importDumpRecord(fields, &mnemonic, &nextIndex)
+		if err != nil {
+			return imported, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+		if added {
+			imported++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return imported, err
+	}
+
+	if mnemonic != "" {
+		if _, err := newAccountKey(mnemonic); err != nil {
+			return imported, err
+		}
+
+		switch {
+		case ws.Mnemonic == "":
+			ws.Mnemonic = mnemonic
+			ws.NextIndex = nextIndex
+		case ws.Mnemonic == mnemonic:
+			if nextIndex > ws.NextIndex {
+				ws.NextIndex = nextIndex
+			}
+		default:
+			fmt.Println("Warning: wallet already has a different mnemonic, the mnemonic from the dump is not imported")
+		}
+	}
+
+	return imported, nil
+}
+
+//导入一条记录，地址已经在钱包中时返回 false
+func (ws *Wallets) importDumpRecord(fields []string, mnemonic *string, nextIndex *uint32) (bool, error) {
+	switch fields[0] {
+	case "mnemonic":
+		*mnemonic = strings.Join(fields[1:], " ")
+		return false, nil
+	case "nextindex":
+		if len(fields) != 2 {
+			return false, errors.New("nextindex needs one value")
+		}
+		index, err := strconv.ParseUint(fields[1], 10, 32)
+		*nextIndex = uint32(index)
+		return false, err
+	}
+
+	if len(fields) < 2 {
+		return false, fmt.Errorf("%s needs a value", fields[0])
+	}
+
+	var address string
+	switch fields[0] {
+	case "privkey":
+		wallet, err := DecodePrivateKey(fields[1])
+		if err != nil {
+			return false, err
+		}
+		address = string(wallet.GetAddress())
+		if err := checkDumpAddress(fields, address); err != nil {
+			return false, err
+		}
+		if _, ok := ws.Wallets[address]; ok {
+			return false, nil
+		}
+		_, err = ws.ImportPrivateKey(wallet)
+		return err == nil, err
+	case "watchpubkey":
+		pubKey, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return false, err
+		}
+		address = string(Wallet{PublicKey: pubKey}.GetAddress())
+		if err := checkDumpAddress(fields, address); err != nil {
+			return false, err
+		}
+		if _, ok := ws.GetPubKeyHash(address); ok {
+			return false, nil
+		}
+		_, err = ws.ImportPubKey(pubKey)
+		return err == nil, err
+	case "watchaddress":
+		address = fields[1]
+		if _, ok := ws.GetPubKeyHash(address); ok {
+			return false, nil
+		}
+		err := ws.ImportAddress(address)
+		return err == nil, err
+	default:
+		return false, fmt.Errorf("unknown record %q", fields[0])
+	}
+}
+
+//记录中的地址是可选的，写了地址时必须与密钥对应的地址一致
+func checkDumpAddress(fields []string, address string) error {
+	if len(fields) > 2 && fields[2] != address {
+		return fmt.Errorf("address %s does not match the key, expected %s", fields[2], address)
+	}
+
+	return nil
+}
+
+//将钱包备份到文件，文件已经存在时不会覆盖
+func (ws *Wallets) DumpToFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = ws.Dump(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+//从备份文件导入钱包
+func (ws *Wallets) ImportFromFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return ws.Import(file)
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportRejectsInvalidWatchPubKey(t *testing.T) {
+	wallets := Wallets{Wallets: make(map[string]*Wallet), WatchOnly: make(map[string]*WatchOnlyEntry)}
+
+	imported, err := wallets.Import(strings.NewReader("watchpubkey 0102\n"))
+	if err == nil {
+		t.Error("an invalid public key was imported without an error")
+	}
+	if imported != 0 || len(wallets.WatchOnly) != 0 {
+		t.Errorf("imported %d records, %d watch-only addresses", imported, len(wallets.WatchOnly))
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/hex"
+	"github.com/boltdb/bolt"
+	"log"
+	"sort"
+	"strconv"
+)
+
+//钱包的余额
+//Confirmed 是已经打包且可以花费的部分，不包括内存池中已经被花费的输出
+//Unconfirmed 是内存池中的交易支付给钱包的部分（包括找零）
+//Immature 是尚未成熟的 coinbase 奖励
+type WalletBalance struct {
+	Confirmed   Amount
+	Unconfirmed Amount
+	Immature    Amount
+}
+
+//钱包中的一个未花费输出，Confirmations 为 0 表示它来自内存池中的交易
+type WalletUnspent struct {
+	Txid          []byte
+	Vout          int
+	Address       string
+	Value         Amount
+	Confirmations int
+	Coinbase      bool
+	Mature        bool
+}
+
+//和钱包有关的一笔交易
+//Received 是支付给钱包地址的输出总额，Sent 是钱包地址花费的输入总额，两者的差就是钱包余额的变化
+//只有所有输入都属于钱包时才能算出手续费，否则 Fee 为 0
+type WalletTransaction struct {
+	TxID          []byte
+	Received      Amount
+	Sent          Amount
+	Fee           Amount
+	Confirmations int
+	Coinbase      bool
+}
+
+//钱包中所有地址（包括只观察的地址）的公钥哈希，键为十六进制的公钥哈希，值为地址
+//查询余额和交易记录只需要它，不需要私钥，因此可以交给正在运行的节点查询
+func (ws *Wallets) PubKeyHashes() map[string]string {
+	hashes := make(map[string]string)
+
+	for _, address := range ws.GetAddresses() {
+		pubKeyHash, _ := ws.GetPubKeyHash(address)
+		hashes[hex.EncodeToString(pubKeyHash)] = address
+	}
+
+	return hashes
+}
+
+//找到钱包在UTXO集和内存池中所有的未花费输出，已经被内存池中的交易花费的输出不计算在内
+//hashes 是 Wallets.PubKeyHashes 的结果
+func FindWalletUnspent(hashes map[string]string, UTXOSet *UTXOSet, mempool []Transaction) []WalletUnspent {
+	var unspent []WalletUnspent
+	bestHeight := UTXOSet.Blockchain.GetBestHeight()
+
+	spentInMempool := make(map[string]bool)
+	for _, tx := range mempool {
+		for _, vin := range tx.Vin {
+			spentInMempool[outpointKey(vin.Txid, vin.Vout)] = true
+		}
+	}
+
+	err := UTXOSet.Blockchain.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			outs := DeserializeOutputs(v)
+			mature := outs.IsMature(bestHeight + 1)
+
+			for outIdx, out := range outs.Outputs {
+				address, ok := hashes[hex.EncodeToString(out.PubKeyHash)]
+				if !ok || spentInMempool[outpointKey(k, outIdx)] {
+					continue
+				}
+
+				//bolt 返回的键只在事务内有效，需要复制一份
+				txID := append([]byte{}, k...)
+				confirmations := bestHeight - outs.Height + 1
+				unspent = append(unspent, WalletUnspent{txID, outIdx, address, out.Value, confirmations, outs.Coinbase, mature})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	for _, tx := range mempool {
+		for outIdx, out := range tx.Vout {
+			address, ok := hashes[hex.EncodeToString(out.PubKeyHash)]
+			if !ok || spentInMempool[outpointKey(tx.ID, outIdx)] {
+				continue
+			}
+			unspent = append(unspent, WalletUnspent{tx.ID, outIdx, address, out.Value, 0, false, true})
+		}
+	}
+
+	//确认数多的排在前面
+	sort.SliceStable(unspent, func(i, j int) bool {
+		return unspent[i].Confirmations > unspent[j].Confirmations
+	})
+
+	return unspent
+}
+
+//由钱包的未花费输出统计整个钱包的余额
+func SumWalletBalance(unspent []WalletUnspent) WalletBalance {
+	var balance WalletBalance
+
+	for _, utxo := range unspent {
+		switch {
+		case utxo.Confirmations == 0:
+			balance.Unconfirmed += utxo.Value
+		case !utxo.Mature:
+			balance.Immature += utxo.Value
+		default:
+			balance.Confirmed += utxo.Value
+		}
+	}
+
+	return balance
+}
+
+//列出钱包的交易记录，从创世区块开始按顺序排列，内存池中的交易排在最后
+func ListWalletTransactions(hashes map[string]string, bc *Blockchain, mempool []Transaction) []WalletTransaction {
+	var history []WalletTransaction
+	bestHeight := bc.GetBestHeight()
+
+	//区块链迭代器从最新的区块开始，先收集所有区块再从创世区块开始处理，这样花费的输出总是先出现
+	var blocks []*Block
+	bci := bc.Iterator()
+	for {
+		block := bci.Next()
+		blocks = append(blocks, block)
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	outputs := make(map[string][]TXOutput)
+	addTransaction := func(tx Transaction, confirmations int) {
+		outputs[hex.EncodeToString(tx.ID)] = tx.Vout
+
+		wtx := WalletTransaction{TxID: tx.ID, Confirmations: confirmations, Coinbase: tx.IsCoinbase()}
+		inputTotal := Amount(0)
+		allInputsOwned := !tx.IsCoinbase()
+		if !tx.IsCoinbase() {
+			for _, vin := range tx.Vin {
+				prevOuts := outputs[hex.EncodeToString(vin.Txid)]
+				if vin.Vout < 0 || vin.Vout >= len(prevOuts) {
+					allInputsOwned = false
+					continue
+				}
+
+				prevOut := prevOuts[vin.Vout]
+				inputTotal += prevOut.Value
+				if _, ok := hashes[hex.EncodeToString(prevOut.PubKeyHash)]; ok {
+					wtx.Sent += prevOut.Value
+				} else {
+					allInputsOwned = false
+				}
+			}
+		}
+
+		outputTotal := Amount(0)
+		for _, out := range tx.Vout {
+			outputTotal += out.Value
+			if _, ok := hashes[hex.EncodeToString(out.PubKeyHash)]; ok {
+				wtx.Received += out.Value
+			}
+		}
+
+		if wtx.Sent == 0 && wtx.Received == 0 {
+			return
+		}
+		if allInputsOwned {
+			wtx.Fee = inputTotal - outputTotal
+		}
+		history = append(history, wtx)
+	}
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		for _, tx := range blocks[i].Transactions {
+			addTransaction(*tx, bestHeight-blocks[i].Height+1)
+		}
+	}
+	for _, tx := range mempool {
+		addTransaction(tx, 0)
+	}
+
+	return history
+}
+
+//输出点的键：交易ID和输出索引
+func outpointKey(txID []byte, vout int) string {
+	return hex.EncodeToString(txID) + ":" + strconv.Itoa(vout)
+}
@@ -2,59 +2,310 @@ package main
 
 import (
 	"bytes"
-	"crypto/elliptic"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 )
 
-const walletFile = "wallet_%s.dat"
+var errWalletEncrypted = errors.New("Wallet file is encrypted, a passphrase is required.")
 
+//只观察的地址：导入公钥时保存公钥，只导入地址时 PubKey 为空
+type WatchOnlyEntry struct {
+	PubKey     []byte
+	PubKeyHash []byte
+}
+
+//passphrase 是钱包文件的密码，保存时用它加密整个钱包；为空时按旧格式保存为明文
+//Mnemonic 不为空时是 HD 钱包，新地址由助记词按顺序派生，NextIndex 是下一个地址的序号
+//旧的钱包文件没有助记词，继续使用随机生成的私钥
+//WatchOnly 是只观察的地址，钱包中没有它们的私钥，只能查询余额，不能签名
 type Wallets struct {
-	Wallets map[string]*Wallet
+	Wallets    map[string]*Wallet
+	WatchOnly  map[string]*WatchOnlyEntry
+	Mnemonic   string
+	NextIndex  uint32
+	passphrase []byte
 }
 
-//新建钱包
+//新建钱包，钱包文件已加密时返回 errWalletEncrypted
 func NewWallets(nodeID string) (*Wallets, error) {
+	return NewWalletsWithPassphrase(nodeID, nil)
+}
+
+//使用密码打开加密的钱包文件
+func NewWalletsWithPassphrase(nodeID string, passphrase []byte) (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.WatchOnly = make(map[string]*WatchOnlyEntry)
+	wallets.passphrase = passphrase
 
 	err := wallets.LoadFromFile(nodeID)
 
 	return &wallets, err
 }
 
-//在钱包中加入新的wallet
+//由助记词新建 HD 钱包，钱包中还没有地址
+func NewHDWallets(mnemonic string) (*Wallets, error) {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	if _, err := newAccountKey(mnemonic); err != nil {
+		return nil, err
+	}
+
+	wallets := Wallets{}
+	wallets.Wallets = make(map[string]*Wallet)
+	wallets.WatchOnly = make(map[string]*WatchOnlyEntry)
+	wallets.Mnemonic = mnemonic
+
+	return &wallets, nil
+}
+
+//由助记词恢复 HD 钱包
+//依次派生地址并用 isUsed 检查是否在链上出现过，连续 hdGapLimit 个地址没有出现过时停止
+//保留最后一个用过的地址之前的所有地址，没有用过的地址时只保留第一个
+func RestoreWallets(mnemonic string, isUsed func(pubKeyHash []byte) bool) (*Wallets, error) {
+	wallets, err := NewHDWallets(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+	accountKey, err := newAccountKey(wallets.Mnemonic)
+	if err != nil {
+		return nil, err
+	}
+
+	var derived []*Wallet
+	lastUsed := -1
+	for i := 0; i-lastUsed <= hdGapLimit; i++ {
+		wallet := NewWalletFromKey(accountKey.Child(uint32(i)).PrivateKey(), KeyTypeP256)
+		derived = append(derived, wallet)
+
+		if isUsed(HashPubKey(wallet.PublicKey)) {
+			lastUsed = i
+		}
+	}
+
+	count := lastUsed + 1
+	if count == 0 {
+		count = 1
+	}
+	for _, wallet := range derived[:count] {
+		wallets.Wallets[string(wallet.GetAddress())] = wallet
+	}
+	wallets.NextIndex = uint32(count)
+
+	return wallets, nil
+}
+
+//检查 HD 钱包再派生 count 个地址后，最后一个用过的地址之后是否超过 hdGapLimit 个没有用过的地址
+//超过时恢复钱包会提前停止查找，之后的地址收到的币会丢失
+func (ws *Wallets) CheckGapLimit(count int, isUsed func(pubKeyHash []byte) bool) error {
+	if ws.Mnemonic == "" {
+		return nil
+	}
+	accountKey, err := newAccountKey(ws.Mnemonic)
+	if err != nil {
+		return err
+	}
+
+	lastUsed := -1
+	for i := 0; i < int(ws.NextIndex); i++ {
+		wallet := NewWalletFromKey(accountKey.Child(uint32(i)).PrivateKey(), KeyTypeP256)
+		if isUsed(HashPubKey(wallet.PublicKey)) {
+			lastUsed = i
+		}
+	}
+
+	unused := int(ws.NextIndex) + count - 1 - lastUsed
+	if unused > hdGapLimit {
+		return fmt.Errorf("Creating %d addresses would leave %d unused addresses in a row, restorewallet only finds %d. Use some of the existing addresses first.", count, unused, hdGapLimit)
+	}
+
+	return nil
+}
+
+//在钱包中加入新的wallet，HD 钱包派生下一个地址
 func (ws *Wallets) CreateWallet() string {
-	wallet := NewWallet()
-	address := fmt.Sprintf("%s", wallet.GetAddress())
+	return ws.CreateWalletWithKeyType(KeyTypeP256)
+}
+
+//在钱包中加入使用指定签名算法的wallet
+//HD 钱包只派生 P-256 的私钥，其他签名算法的私钥随机生成，需要用 dumpwallet 单独备份
+func (ws *Wallets) CreateWalletWithKeyType(keyType KeyType) string {
+	return ws.CreateWallets(keyType, 1)[0]
+}
+
+//一次在钱包中加入 count 个wallet，调用者只需要保存一次钱包文件
+func (ws *Wallets) CreateWallets(keyType KeyType, count int) []string {
+	var addresses []string
+
+	var accountKey *ExtendedKey
+	if keyType == KeyTypeP256 && ws.Mnemonic != "" {
+		var err error
+		accountKey, err = newAccountKey(ws.Mnemonic)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		var wallet *Wallet
+		if keyType != KeyTypeP256 {
+			wallet = NewWalletWithKeyType(keyType)
+		} else if accountKey != nil {
+			wallet = NewWalletFromKey(accountKey.Child(ws.NextIndex).PrivateKey(), KeyTypeP256)
+			ws.NextIndex++
+		} else {
+			wallet = NewWallet()
+		}
+
+		address := ws.AddWallet(wallet)
+		addresses = append(addresses, address)
+	}
 
+	return addresses
+}
+
+//在钱包中加入一个已经生成好的wallet，返回它的地址
+func (ws *Wallets) AddWallet(wallet *Wallet) string {
+	address := fmt.Sprintf("%s", wallet.GetAddress())
 	ws.Wallets[address] = wallet
 
 	return address
 }
 
-//获得钱包中的地址内容
+//导入私钥，返回它对应的地址，已经只观察的地址会变成带私钥的地址
+func (ws *Wallets) ImportPrivateKey(wallet *Wallet) (string, error) {
+	address := string(wallet.GetAddress())
+
+	if _, ok := ws.Wallets[address]; ok {
+		return address, fmt.Errorf("Address %s is already in the wallet.", address)
+	}
+	delete(ws.WatchOnly, address)
+	ws.Wallets[address] = wallet
+
+	return address, nil
+}
+
+//导入只观察的地址
+func (ws *Wallets) ImportAddress(address string) error {
+	pubKeyHash, err := DecodeAddress(address)
+	if err != nil {
+		return err
+	}
+	address = normalizeAddress(address)
+
+	return ws.addWatchOnly(address, &WatchOnlyEntry{nil, pubKeyHash})
+}
+
+//导入只观察的公钥，返回它对应的地址
+func (ws *Wallets) ImportPubKey(pubKey []byte) (string, error) {
+	if _, err := ParseVerifier(pubKey); err != nil {
+		return "", err
+	}
+
+	wallet := Wallet{PublicKey: pubKey}
+	address := string(wallet.GetAddress())
+
+	return address, ws.addWatchOnly(address, &WatchOnlyEntry{pubKey, HashPubKey(pubKey)})
+}
+
+func (ws *Wallets) addWatchOnly(address string, entry *WatchOnlyEntry) error {
+	if _, ok := ws.Wallets[address]; ok {
+		return fmt.Errorf("Address %s is already in the wallet with its private key.", address)
+	}
+
+	//已经只导入了地址时，用带公钥的记录替换它
+	if old, ok := ws.WatchOnly[address]; ok && (len(old.PubKey) > 0 || len(entry.PubKey) == 0) {
+		return fmt.Errorf("Address %s is already watched.", address)
+	}
+	ws.WatchOnly[address] = entry
+
+	return nil
+}
+
+//判断地址是否是只观察的地址
+func (ws *Wallets) IsWatchOnly(address string) bool {
+	_, ok := ws.WatchOnly[normalizeAddress(address)]
+
+	return ok
+}
+
+//获得钱包中的地址内容，包括只观察的地址
 func (ws *Wallets) GetAddresses() []string {
 	var addresses []string
 
 	for address := range ws.Wallets {
 		addresses = append(addresses, address)
 	}
+	for address := range ws.WatchOnly {
+		addresses = append(addresses, address)
+	}
 
 	return addresses
 }
 
-//获取特定地址的钱包
+//获取地址的公钥哈希，地址不在钱包中时返回 false
+func (ws *Wallets) GetPubKeyHash(address string) ([]byte, bool) {
+	address = normalizeAddress(address)
+	if wallet, ok := ws.Wallets[address]; ok {
+		return HashPubKey(wallet.PublicKey), true
+	}
+	if entry, ok := ws.WatchOnly[address]; ok {
+		return entry.PubKeyHash, true
+	}
+
+	return nil, false
+}
+
+//钱包中地址的 Bech32 形式，只知道公钥哈希的只观察地址使用版本 0
+func (ws *Wallets) GetBech32Address(address string) string {
+	address = normalizeAddress(address)
+	if wallet, ok := ws.Wallets[address]; ok {
+		return string(wallet.GetBech32Address())
+	}
+
+	entry, ok := ws.WatchOnly[address]
+	if !ok {
+		log.Panicf("ERROR: Address %s is not in the wallet", address)
+	}
+	if verifier, err := ParseVerifier(entry.PubKey); err == nil {
+		return string(Wallet{PublicKey: entry.PubKey, KeyType: verifier.KeyType()}.GetBech32Address())
+	}
+
+	return encodeBech32Address(witnessVersionECDSA, entry.PubKeyHash)
+}
+
+//获取特定地址的钱包，只观察的地址没有私钥
+//Bech32 地址与同一个公钥哈希的 Base58Check 地址对应同一个钱包
 func (ws *Wallets) GetWallet(address string) Wallet {
-	return *ws.Wallets[address]
+	wallet, ok := ws.Wallets[normalizeAddress(address)]
+	if !ok {
+		if ws.IsWatchOnly(address) {
+			log.Panicf("ERROR: Address %s is watch-only, sign its transactions with createrawtx and signrawtx", address)
+		}
+		log.Panicf("ERROR: Address %s is not in the wallet", address)
+	}
+
+	return *wallet
+}
+
+//获取公钥哈希对应的钱包
+func (ws *Wallets) GetWalletByPubKeyHash(pubKeyHash []byte) (*Wallet, bool) {
+	for _, wallet := range ws.Wallets {
+		if bytes.Compare(HashPubKey(wallet.PublicKey), pubKeyHash) == 0 {
+			return wallet, true
+		}
+	}
+
+	return nil, false
 }
 
 //读取文件内容并写入钱包中
 func (ws *Wallets) LoadFromFile(nodeID string) error {
-	walletFile := fmt.Sprintf(walletFile, nodeID)
+	walletFile := walletPath(nodeID)
 	//返回文件名的信息描述
 	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
 		return err
@@ -66,26 +317,102 @@ func (ws *Wallets) LoadFromFile(nodeID string) error {
 		log.Panic(err)
 	}
 
+	//加密的钱包文件需要先用密码解密
+	if isEncryptedWallet(fileContent) {
+		if len(ws.passphrase) == 0 {
+			return errWalletEncrypted
+		}
+
+		fileContent, err = decryptWallet(fileContent, ws.passphrase)
+		if err != nil {
+			return err
+		}
+	} else if len(ws.passphrase) > 0 {
+		return errors.New("Wallet file is not encrypted, run encryptwallet first.")
+	}
+
 	//对文件内容进行解码
-	var wallets Wallets
-	gob.Register(elliptic.P256())
-	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
-	err = decoder.Decode(&wallets)
+	wallets, err := decodeWallets(fileContent)
 	if err != nil {
 		log.Panic(err)
 	}
 
 	ws.Wallets = wallets.Wallets
+	//旧的钱包文件中没有只观察的地址
+	ws.WatchOnly = wallets.WatchOnly
+	if ws.WatchOnly == nil {
+		ws.WatchOnly = make(map[string]*WatchOnlyEntry)
+	}
+	ws.Mnemonic = wallets.Mnemonic
+	ws.NextIndex = wallets.NextIndex
+	ws.fixAddressKeys()
 
 	return nil
 }
 
+//解码钱包文件的内容，无法按现在的格式解码时按最早的明文格式解码，
+//这样旧的钱包文件可以继续使用，也可以用 encryptwallet 加密
+func decodeWallets(content []byte) (Wallets, error) {
+	var wallets Wallets
+	decoder := gob.NewDecoder(bytes.NewReader(content))
+	err := decoder.Decode(&wallets)
+	if err == nil {
+		return wallets, nil
+	}
+
+	var legacy struct {
+		Wallets map[string]*legacyWallet
+	}
+	decoder = gob.NewDecoder(bytes.NewReader(content))
+	if decoder.Decode(&legacy) != nil {
+		return wallets, err
+	}
+
+	wallets = Wallets{Wallets: make(map[string]*Wallet)}
+	for address, lw := range legacy.Wallets {
+		wallet, err := lw.wallet()
+		if err != nil {
+			return wallets, err
+		}
+		wallets.Wallets[address] = wallet
+	}
+
+	return wallets, nil
+}
+
+//旧版本的 Base58 编码丢失了公钥哈希开头的 0x00 字节，这样的地址无法通过校验
+//加载钱包时按照正确的编码重新生成地址
+func (ws *Wallets) fixAddressKeys() {
+	for address, wallet := range ws.Wallets {
+		if fixed := string(wallet.GetAddress()); fixed != address {
+			delete(ws.Wallets, address)
+			ws.Wallets[fixed] = wallet
+		}
+	}
+	for address, entry := range ws.WatchOnly {
+		if fixed := encodeBase58Address(entry.PubKeyHash); fixed != address {
+			delete(ws.WatchOnly, address)
+			ws.WatchOnly[fixed] = entry
+		}
+	}
+}
+
+//判断钱包是否会被加密保存
+func (ws *Wallets) IsEncrypted() bool {
+	return len(ws.passphrase) > 0
+}
+
+//设置新的钱包密码，下一次 SaveToFile 时生效
+//旧的明文钱包通过这种方式迁移为加密钱包
+func (ws *Wallets) SetPassphrase(passphrase []byte) {
+	ws.passphrase = passphrase
+}
+
 //将特定钱包的内容编码后写入文件中
+//设置了密码时整个文件都会被加密，文件只有当前用户可以读写
 func (ws Wallets) SaveToFile(nodeID string) {
 	var content bytes.Buffer
-	walletFile := fmt.Sprintf(walletFile, nodeID)
-
-	gob.Register(elliptic.P256())
+	walletFile := walletPath(nodeID)
 
 	encoder := gob.NewEncoder(&content)
 	err := encoder.Encode(ws)
@@ -93,7 +420,13 @@ func (ws Wallets) SaveToFile(nodeID string) {
 		log.Panic(err)
 	}
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
+	data := content.Bytes()
+	if ws.IsEncrypted() {
+		data = encryptWallet(data, ws.passphrase)
+	}
+
+	//替换文件时同时修正旧文件的权限
+	err = writeFileAtomic(walletFile, data, 0600)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+//旧版本的 Go 把 elliptic.P256() 注册为 crypto/elliptic.p256Curve，它只有一个 *CurveParams 字段
+type legacyTestCurve struct {
+	*elliptic.CurveParams
+}
+
+//最早版本的钱包文件格式
+type legacyTestWallet struct {
+	PrivateKey ecdsa.PrivateKey
+	PublicKey  []byte
+}
+
+type legacyTestWallets struct {
+	Wallets map[string]*legacyTestWallet
+}
+
+func TestLoadLegacyWalletFile(t *testing.T) {
+	private, _ := newKeyPair()
+	private.Curve = legacyTestCurve{elliptic.P256().Params()}
+	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+	address := encodeBase58Address(HashPubKey(pubKey))
+
+	var content bytes.Buffer
+	gob.RegisterName("crypto/elliptic.p256Curve", legacyTestCurve{})
+	err := gob.NewEncoder(&content).Encode(legacyTestWallets{map[string]*legacyTestWallet{
+		address: {private, pubKey},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeID := "legacytest"
+	err = ioutil.WriteFile(walletPath(nodeID), content.Bytes(), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(walletPath(nodeID))
+
+	wallets, err := NewWallets(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet, ok := wallets.Wallets[address]
+	if !ok {
+		t.Fatalf("address %s is missing, got %v", address, wallets.GetAddresses())
+	}
+	if string(wallet.GetAddress()) != address {
+		t.Errorf("address changed to %s", wallet.GetAddress())
+	}
+	if wallet.PrivateKey.D.Cmp(private.D) != 0 || wallet.PrivateKey.X.Cmp(private.X) != 0 {
+		t.Error("private key does not match")
+	}
+
+	//迁移后的钱包可以按新格式保存和读取
+	wallets.SaveToFile(nodeID)
+	reloaded, err := NewWallets(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Wallets[address]; !ok {
+		t.Error("address is missing after saving")
+	}
+}
+
+func TestCheckGapLimit(t *testing.T) {
+	wallets, err := NewHDWallets(NewMnemonic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := make(map[string]bool)
+	isUsed := func(pubKeyHash []byte) bool {
+		return used[string(pubKeyHash)]
+	}
+
+	if err := wallets.CheckGapLimit(hdGapLimit+1, isUsed); err == nil {
+		t.Error("more than hdGapLimit unused addresses were allowed")
+	}
+	if err := wallets.CheckGapLimit(hdGapLimit, isUsed); err != nil {
+		t.Error(err)
+	}
+
+	addresses := wallets.CreateWallets(KeyTypeP256, hdGapLimit)
+	if err := wallets.CheckGapLimit(1, isUsed); err == nil {
+		t.Error("an address past the gap limit was allowed")
+	}
+
+	//用过的地址之后可以再派生 hdGapLimit 个地址
+	used[string(HashPubKey(wallets.Wallets[addresses[4]].PublicKey))] = true
+	if err := wallets.CheckGapLimit(5, isUsed); err != nil {
+		t.Error(err)
+	}
+	if err := wallets.CheckGapLimit(6, isUsed); err == nil {
+		t.Error("an address past the gap limit after the last used one was allowed")
+	}
+}
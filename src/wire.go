@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+//P2P 消息的格式，与比特币相同：
+//  Magic（4 字节）+ 命令（12 字节，不足补 0）+ 数据长度（4 字节，小端）+ 校验和（4 字节）+ 数据
+//校验和是数据双重 SHA-256 的前 4 个字节，与地址的校验和相同
+//读取数据之前先检查长度，超过 maxMessagePayload 的消息不会被读入内存
+//数据按实际收到的字节增长缓冲区，声明了很大的长度却不发送数据的对方不能让节点预先分配内存
+const messageHeaderLength = magicLength + commandLength + 4 + addressChecksumLen
+
+//一条消息的数据最大为 4MB，最大的消息是区块，挖矿时区块中的交易不超过它的一半
+const maxMessagePayload = 4 * 1024 * 1024
+
+var errMessageMagic = errors.New("not a message of this network")
+
+type message struct {
+	Command string
+	Payload []byte
+}
+
+//写入一条消息
+func writeMessage(w io.Writer, command string, payload []byte) error {
+	if len(command) > commandLength {
+		return fmt.Errorf("command %q is longer than %d bytes", command, commandLength)
+	}
+	if len(payload) > maxMessagePayload {
+		return fmt.Errorf("payload of %d bytes exceeds the maximum of %d", len(payload), maxMessagePayload)
+	}
+
+	header := make([]byte, 0, messageHeaderLength)
+	header = append(header, activeNetParams.Magic[:]...)
+	header = append(header, commandToBytes(command)...)
+	header = append(header, make([]byte, 4)...)
+	binary.LittleEndian.PutUint32(header[magicLength+commandLength:], uint32(len(payload)))
+	header = append(header, checksum(payload)...)
+
+	_, err := w.Write(append(header, payload...))
+
+	return err
+}
+
+//读取一条消息，格式错误时返回错误
+//对方正常关闭连接时返回 io.EOF，消息读到一半连接断开时返回 io.ErrUnexpectedEOF
+func readMessage(r io.Reader) (*message, error) {
+	header := make([]byte, messageHeaderLength)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:magicLength], activeNetParams.Magic[:]) {
+		return nil, errMessageMagic
+	}
+	header = header[magicLength:]
+
+	command, err := parseCommand(header[:commandLength])
+	if err != nil {
+		return nil, err
+	}
+	header = header[commandLength:]
+
+	length := binary.LittleEndian.Uint32(header[:4])
+	if length > maxMessagePayload {
+		return nil, fmt.Errorf("%s message of %d bytes exceeds the maximum of %d", command, length, maxMessagePayload)
+	}
+
+	var payload bytes.Buffer
+	n, err := payload.ReadFrom(io.LimitReader(r, int64(length)))
+	if err != nil {
+		return nil, err
+	}
+	if n < int64(length) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if !bytes.Equal(checksum(payload.Bytes()), header[4:]) {
+		return nil, fmt.Errorf("%s message has an invalid checksum", command)
+	}
+
+	return &message{command, payload.Bytes()}, nil
+}
+
+//命令只能包含可打印的 ASCII 字符，后面用 0 补齐
+func parseCommand(b []byte) (string, error) {
+	command := bytesToCommand(b)
+	if command == "" {
+		return "", errors.New("empty command")
+	}
+
+	for i, c := range b {
+		if c == 0x0 {
+			if bytes.Count(b[i:], []byte{0x0}) != len(b)-i {
+				return "", errors.New("command is not zero padded")
+			}
+			break
+		}
+		if c < 0x20 || c > 0x7e {
+			return "", fmt.Errorf("command contains invalid byte 0x%02x", c)
+		}
+	}
+
+	return command, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestReadMessageRoundTrip(t *testing.T) {
+	var buff bytes.Buffer
+	if err := writeMessage(&buff, "ping", []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := readMessage(&buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Command != "ping" || !bytes.Equal(msg.Payload, []byte{1, 2, 3}) {
+		t.Errorf("read %q %x", msg.Command, msg.Payload)
+	}
+}
+
+//只有消息头声明的长度而没有数据时，读到连接结束就返回错误
+func TestReadMessageTruncatedPayload(t *testing.T) {
+	var buff bytes.Buffer
+	writeMessage(&buff, "block", make([]byte, 100))
+	header := buff.Bytes()[:messageHeaderLength]
+	binary.LittleEndian.PutUint32(header[magicLength+commandLength:], maxMessagePayload)
+
+	_, err := readMessage(bytes.NewReader(append(header, make([]byte, 10)...)))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestReadMessageTooLarge(t *testing.T) {
+	var buff bytes.Buffer
+	writeMessage(&buff, "block", nil)
+	header := buff.Bytes()[:messageHeaderLength]
+	binary.LittleEndian.PutUint32(header[magicLength+commandLength:], maxMessagePayload+1)
+
+	_, err := readMessage(bytes.NewReader(header))
+	expectError(t, err, "exceeds the maximum")
+	expectError(t, writeMessage(ioutil.Discard, "block", make([]byte, maxMessagePayload+1)), "exceeds the maximum")
+}